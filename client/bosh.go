@@ -0,0 +1,510 @@
+// bosh
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// XEP-0124: Bidirectional-streams Over Synchronous HTTP (BOSH)
+// XEP-0206: XMPP Over BOSH
+const (
+	nsHTTPBind = "http://jabber.org/protocol/httpbind"
+	nsXBOSH    = "urn:xmpp:xbosh"
+
+	boshWait = 60 // seconds
+	boshHold = 1
+)
+
+// boshResponse is a response of the connection manager.
+type boshResponse struct {
+	payload []byte
+	err     error
+}
+
+// boshConn is a BOSH session seen as a connection: Write queues payloads to be
+// sent in the next request, Read returns the payloads of the responses in the
+// order of their rid. A request is kept pending at the connection manager so
+// that it can send at any time.
+type boshConn struct {
+	url    string
+	to     string
+	client *http.Client
+	// the context of the requests, canceled by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock sync.Mutex
+	// signals the changes of the fields below
+	cond *sync.Cond
+
+	sid       string
+	rid       uint64 // rid of the last request
+	next      uint64 // rid of the next response to read
+	responses map[uint64]*boshResponse
+	inflight  int
+	requests  int // maximum number of simultaneous requests
+	hold      int
+	wait      time.Duration
+	polling   time.Duration
+
+	opened   bool   // the stream of the session creation has been read
+	restart  bool   // the next request restarts the stream
+	out      []byte // payloads to send
+	in       []byte // payloads to read
+	err      error
+	closed   bool
+	deadline time.Time
+}
+
+// newBOSH creates a BOSH session with the connection manager at url for the domain.
+// It returns the session with the TLS state of the connection, if encrypted.
+func newBOSH(ctx context.Context, client *http.Client, url, domain string) (*boshConn, *tls.ConnectionState, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, nil, err
+	}
+
+	c := &boshConn{
+		url:       url,
+		to:        domain,
+		client:    client,
+		rid:       binary.BigEndian.Uint64(b[:]) >> 12, // at most 2^52, see XEP-0124 14.1
+		responses: make(map[uint64]*boshResponse),
+	}
+	c.cond = sync.NewCond(&c.lock)
+	// the session outlives ctx, which only bounds its creation.
+	c.ctx, c.cancel = context.WithCancel(context.WithoutCancel(ctx))
+
+	body := fmt.Sprintf("<body xmlns='%s' xmlns:xmpp='%s' content='text/xml; charset=utf-8' "+
+		"rid='%d' to='%s' ver='1.6' wait='%d' hold='%d' xml:lang='en' xmpp:version='1.0'/>",
+		nsHTTPBind, nsXBOSH, c.rid, xmlEscape(domain), boshWait, boshHold)
+	attrs, payload, state, err := c.post(ctx, []byte(body))
+	if err != nil {
+		c.cancel()
+		return nil, nil, err
+	}
+	if attrs["type"] == "terminate" {
+		c.cancel()
+		return nil, nil, boshTerminated(attrs["condition"])
+	}
+	if attrs["sid"] == "" {
+		c.cancel()
+		return nil, nil, errors.New("bosh: no sid in the session creation response")
+	}
+
+	c.sid = attrs["sid"]
+	c.next = c.rid + 1
+	c.in = payload
+	c.hold = boshHold
+	if n, err := strconv.Atoi(attrs["hold"]); err == nil {
+		c.hold = n
+	}
+	c.requests = c.hold + 1
+	if n, err := strconv.Atoi(attrs["requests"]); err == nil && n > 0 {
+		c.requests = n
+	}
+	c.wait = boshWait * time.Second
+	if n, err := strconv.Atoi(attrs["wait"]); err == nil && n > 0 {
+		c.wait = time.Duration(n) * time.Second
+	}
+	if n, err := strconv.Atoi(attrs["polling"]); err == nil {
+		c.polling = time.Duration(n) * time.Second
+	}
+
+	go c.run()
+	return c, state, nil
+}
+
+// run sends the requests: the queued payloads when a request can be made,
+// or an empty one to poll when no request is pending.
+func (c *boshConn) run() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for {
+		for c.err == nil && !c.closed && !c.ready() {
+			c.cond.Wait()
+		}
+		if c.err != nil || c.closed {
+			return
+		}
+
+		c.rid++
+		attrs := ""
+		payload := c.out
+		c.out = nil
+		if payload == nil && c.restart {
+			attrs = fmt.Sprintf(" xmlns:xmpp='%s' to='%s' xml:lang='en' xmpp:restart='true'",
+				nsXBOSH, xmlEscape(c.to))
+			c.restart = false
+		}
+		body := c.body(c.rid, attrs, payload)
+		c.inflight++
+
+		go c.request(c.rid, body, len(payload) == 0 && attrs == "")
+	}
+}
+
+// ready tells whether a request should be sent.
+func (c *boshConn) ready() bool {
+	if len(c.out) > 0 || c.restart {
+		return c.inflight < c.requests
+	}
+	return c.inflight == 0 && c.opened
+}
+
+func (c *boshConn) body(rid uint64, attrs string, payload []byte) []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "<body xmlns='%s' rid='%d' sid='%s'%s>", nsHTTPBind, rid, xmlEscape(c.sid), attrs)
+	b.Write(payload)
+	b.WriteString("</body>")
+	return b.Bytes()
+}
+
+// request sends a request and queues its response to be read in order.
+// Failed requests are retried with the same rid (XEP-0124 14.3).
+func (c *boshConn) request(rid uint64, body []byte, poll bool) {
+	var attrs map[string]string
+	var payload []byte
+	var err error
+	for retry := 0; retry < 3; retry++ {
+		ctx, cancel := context.WithTimeout(c.ctx, c.wait+10*time.Second)
+		attrs, payload, _, err = c.post(ctx, body)
+		cancel()
+		if _, ok := err.(*boshHTTPError); ok || err == nil {
+			break
+		}
+		if c.isClosed() {
+			return
+		}
+	}
+
+	resp := &boshResponse{payload: payload, err: err}
+	if err == nil && attrs["type"] == "terminate" {
+		resp.err = boshTerminated(attrs["condition"])
+	}
+
+	// without hold, the connection manager answers at once: wait before polling again.
+	if poll && err == nil && len(payload) == 0 && c.hold == 0 {
+		time.Sleep(c.polling)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.inflight--
+	c.responses[rid] = resp
+	for r, ok := c.responses[c.next]; ok; r, ok = c.responses[c.next] {
+		delete(c.responses, c.next)
+		c.next++
+		c.in = append(c.in, r.payload...)
+		if r.err != nil && c.err == nil {
+			c.err = r.err
+		}
+	}
+	c.cond.Broadcast()
+}
+
+// post sends a request, returning the attributes and the payload of the response body.
+func (c *boshConn) post(ctx context.Context, body []byte) (map[string]string, []byte, *tls.ConnectionState, error) {
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, nil, &boshHTTPError{Status: resp.Status}
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	attrs, payload, err := parseBOSHBody(data)
+	return attrs, payload, resp.TLS, err
+}
+
+// parseBOSHBody returns the attributes of the <body/> wrapper and its children,
+// re-encoded so that they do not depend on the namespaces declared by the wrapper.
+func parseBOSHBody(data []byte) (map[string]string, []byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	se, err := nextStart(dec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if se.Name.Space != nsHTTPBind || se.Name.Local != "body" {
+		return nil, nil, errors.New("bosh: unexpected <" + se.Name.Local + "> wrapper")
+	}
+	attrs := make(map[string]string)
+	for _, attr := range se.Attr {
+		attrs[attr.Name.Local] = attr.Value
+	}
+
+	b := &bytes.Buffer{}
+	enc := xml.NewEncoder(b)
+	for depth := 0; ; {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			depth++
+			var a []xml.Attr
+			for _, attr := range t.Attr {
+				if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+					a = append(a, attr)
+				}
+			}
+			t.Attr = a
+			err = enc.EncodeToken(t)
+		case xml.EndElement:
+			if depth == 0 {
+				if err := enc.Flush(); err != nil {
+					return nil, nil, err
+				}
+				return attrs, b.Bytes(), nil
+			}
+			depth--
+			err = enc.EncodeToken(t)
+		case xml.CharData:
+			if depth > 0 {
+				err = enc.EncodeToken(t)
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func (c *boshConn) Read(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for len(c.in) == 0 && c.err == nil && !c.closed {
+		if !c.deadline.IsZero() && !time.Now().Before(c.deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		c.cond.Wait()
+	}
+	if len(c.in) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, c.in)
+	c.in = c.in[n:]
+	return n, nil
+}
+
+func (c *boshConn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.closed {
+		return 0, errors.New("bosh: session terminated")
+	}
+	c.out = append(c.out, p...)
+	c.cond.Broadcast()
+	return len(p), nil
+}
+
+// openStream restarts the stream (XEP-0206 5), except the first time: the
+// stream is opened by the session creation.
+func (c *boshConn) openStream() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.opened {
+		c.restart = true
+	}
+	c.opened = true
+	c.cond.Broadcast()
+}
+
+// Close terminates the session, sending the queued payloads along, and cancels
+// the pending requests.
+func (c *boshConn) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.rid++
+	body := c.body(c.rid, " type='terminate'", c.out)
+	c.out = nil
+	failed := c.err != nil
+	c.cond.Broadcast()
+	c.lock.Unlock()
+
+	c.cancel()
+	if failed {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.ctx), 10*time.Second)
+	defer cancel()
+	_, _, _, err := c.post(ctx, body)
+	return err
+}
+
+func (c *boshConn) isClosed() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.closed
+}
+
+func (c *boshConn) LocalAddr() net.Addr {
+	return boshAddr("")
+}
+
+func (c *boshConn) RemoteAddr() net.Addr {
+	return boshAddr(c.url)
+}
+
+// SetDeadline sets the deadline of Read. Writes never block.
+func (c *boshConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *boshConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.deadline = t
+	if !t.IsZero() {
+		time.AfterFunc(time.Until(t), func() {
+			c.lock.Lock()
+			c.cond.Broadcast()
+			c.lock.Unlock()
+		})
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *boshConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type boshAddr string
+
+func (_ boshAddr) Network() string {
+	return "bosh"
+}
+
+func (a boshAddr) String() string {
+	return string(a)
+}
+
+// boshHTTPError is an HTTP error status, which ends the session (XEP-0124 19).
+type boshHTTPError struct {
+	Status string
+}
+
+func (e *boshHTTPError) Error() string {
+	return "bosh: " + e.Status
+}
+
+func boshTerminated(condition string) error {
+	if condition == "" {
+		return errors.New("bosh: session terminated")
+	}
+	return errors.New("bosh: session terminated: " + condition)
+}
+
+func xmlEscape(s string) string {
+	b := &bytes.Buffer{}
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
+
+// dialBOSH creates a BOSH session with Options.BOSHURL, or the connection
+// managers discovered with XEP-0156.
+func (c *Client) dialBOSH(ctx context.Context, domain string) error {
+	urls := []string{c.Opts.BOSHURL}
+	if c.Opts.BOSHURL == "" {
+		var err error
+		if urls, err = lookupHostMeta(ctx, c.httpClient(), domain, relBOSH); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	for _, url := range urls {
+		var bosh *boshConn
+		var state *tls.ConnectionState
+		if bosh, state, err = newBOSH(ctx, c.httpClient(), url, domain); err == nil {
+			return c.setTransport(&boshTransport{
+				xmlStream: newXMLStream(bosh, c.logger(), true),
+				bosh:      bosh,
+				tlsState:  state,
+			})
+		}
+		if ctx.Err() != nil {
+			return contextError(ctx.Err())
+		}
+		if c.Opts.Debug {
+			fmt.Println("connect", url, "failed:", err)
+		}
+	}
+	return err
+}
+
+// boshTransport carries the stream in the payloads of a BOSH session.
+type boshTransport struct {
+	*xmlStream
+	bosh     *boshConn
+	tlsState *tls.ConnectionState
+}
+
+// OpenStream does not send anything: the stream to the domain is opened by
+// the session creation, there is no stream header over BOSH.
+func (t *boshTransport) OpenStream(domain string) error {
+	t.bosh.openStream()
+	return nil
+}
+
+func (t *boshTransport) RestartStream() error {
+	t.bosh.openStream()
+	return nil
+}
+
+func (t *boshTransport) StartTLS(config *tls.Config) (*tls.ConnectionState, error) {
+	return nil, ErrStartTLSUnsupported
+}
+
+func (t *boshTransport) ConnectionState() *tls.ConnectionState {
+	return t.tlsState
+}
+
+// Close terminates the session.
+func (t *boshTransport) Close() error {
+	return t.conn.Close()
+}
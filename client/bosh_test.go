@@ -0,0 +1,288 @@
+// bosh test
+package client
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/ginuerzh/goxmpp/core"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// boshRequest is a request received by a fake connection manager.
+type boshRequest struct {
+	Rid     uint64 `xml:"rid,attr"`
+	Sid     string `xml:"sid,attr"`
+	Type    string `xml:"type,attr"`
+	To      string `xml:"to,attr"`
+	Ver     string `xml:"ver,attr"`
+	Hold    string `xml:"hold,attr"`
+	Wait    string `xml:"wait,attr"`
+	Version string `xml:"urn:xmpp:xbosh version,attr"`
+	Restart string `xml:"urn:xmpp:xbosh restart,attr"`
+	Inner   string `xml:",innerxml"`
+}
+
+// poll tells whether the request is an empty one, kept by the connection
+// manager until it has something to send.
+func (req *boshRequest) poll() bool {
+	return req.Inner == "" && req.Type == "" && req.Restart == ""
+}
+
+// newFakeCM starts a fake connection manager answering the requests with the
+// body returned by handle.
+func newFakeCM(t *testing.T, handle func(r *http.Request, req *boshRequest) string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		req := &boshRequest{}
+		if err := xml.Unmarshal(data, req); err != nil {
+			t.Errorf("request %q: %v", data, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(handle(r, req)))
+	}))
+}
+
+const boshFeatures = "<body xmlns='http://jabber.org/protocol/httpbind' " +
+	"xmlns:stream='http://etherx.jabber.org/streams' sid='s1' wait='30' requests='2' hold='1'>" +
+	"<stream:features><mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'>" +
+	"<mechanism>PLAIN</mechanism></mechanisms></stream:features></body>"
+
+const boshEmpty = "<body xmlns='http://jabber.org/protocol/httpbind'/>"
+
+// hold keeps a poll until the test ends.
+func hold(r *http.Request, stop <-chan struct{}) string {
+	select {
+	case <-stop:
+	case <-r.Context().Done():
+	}
+	return boshEmpty
+}
+
+func TestBOSHSession(t *testing.T) {
+	stop := make(chan struct{})
+	var create, terminate *boshRequest
+	cm := newFakeCM(t, func(r *http.Request, req *boshRequest) string {
+		switch {
+		case req.Sid == "":
+			create = req
+			return boshFeatures
+		case req.Type == "terminate":
+			terminate = req
+			close(stop)
+			return "<body xmlns='http://jabber.org/protocol/httpbind' type='terminate'/>"
+		case req.poll():
+			return hold(r, stop)
+		}
+		t.Errorf("unexpected request %+v", req)
+		return boshEmpty
+	})
+	defer cm.Close()
+
+	conn, _, err := newBOSH(context.Background(), cm.Client(), cm.URL, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if create.To != "example.com" || create.Ver != "1.6" || create.Version != "1.0" || create.Hold != "1" {
+		t.Errorf("unexpected session creation request %+v", create)
+	}
+	if conn.sid != "s1" || conn.requests != 2 || conn.wait != 30*time.Second {
+		t.Errorf("got sid %q, requests %d, wait %v", conn.sid, conn.requests, conn.wait)
+	}
+
+	// the payloads do not depend on the namespaces declared by the <body/> wrapper.
+	s := newXMLStream(conn, nil, true)
+	e, err := s.ReadElement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.(*core.StreamFeatures); !ok {
+		t.Fatalf("got %T, want the stream features", e)
+	}
+
+	conn.openStream()
+	conn.Write([]byte("<presence/>"))
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if terminate == nil {
+		t.Fatal("no terminate request")
+	}
+	if terminate.Sid != "s1" || terminate.Inner != "<presence/>" {
+		t.Errorf("unexpected terminate request %+v", terminate)
+	}
+}
+
+func TestBOSHRidOrder(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	received := make(chan uint64, 2)
+	release := make(chan struct{})
+	var rid uint64
+	cm := newFakeCM(t, func(r *http.Request, req *boshRequest) string {
+		switch {
+		case req.Sid == "":
+			rid = req.Rid
+			return boshFeatures
+		case req.Type == "terminate":
+			return boshEmpty
+		case req.Rid == rid+1:
+			// answered after the next request.
+			received <- req.Rid
+			<-release
+			return "<body xmlns='http://jabber.org/protocol/httpbind'><message xmlns='jabber:client' id='1'/></body>"
+		case req.Rid == rid+2:
+			received <- req.Rid
+			return "<body xmlns='http://jabber.org/protocol/httpbind'><message xmlns='jabber:client' id='2'/></body>"
+		}
+		return hold(r, stop)
+	})
+	defer cm.Close()
+
+	conn, _, err := newBOSH(context.Background(), cm.Client(), cm.URL, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := newXMLStream(conn, nil, true)
+	if _, err := s.ReadElement(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Write([]byte("<iq xmlns='jabber:client' id='a'/>"))
+	if r := <-received; r != rid+1 {
+		t.Fatalf("got rid %d, want %d", r, rid+1)
+	}
+	conn.Write([]byte("<iq xmlns='jabber:client' id='b'/>"))
+	if r := <-received; r != rid+2 {
+		t.Fatalf("got rid %d, want %d", r, rid+2)
+	}
+	// release the first response once the second is received.
+	for {
+		conn.lock.Lock()
+		_, ok := conn.responses[rid+2]
+		conn.lock.Unlock()
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	for _, want := range []string{"1", "2"} {
+		e, err := s.ReadElement()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := e.(interface{ Id() string }).Id(); id != want {
+			t.Errorf("got message %s, want %s", id, want)
+		}
+	}
+}
+
+func TestBOSHRestart(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	restart := make(chan *boshRequest, 1)
+	cm := newFakeCM(t, func(r *http.Request, req *boshRequest) string {
+		switch {
+		case req.Sid == "":
+			return boshFeatures
+		case req.Restart != "":
+			restart <- req
+			return "<body xmlns='http://jabber.org/protocol/httpbind' " +
+				"xmlns:stream='http://etherx.jabber.org/streams'><stream:features/></body>"
+		case req.poll():
+			return hold(r, stop)
+		}
+		return boshEmpty
+	})
+	defer cm.Close()
+
+	conn, _, err := newBOSH(context.Background(), cm.Client(), cm.URL, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the first stream is opened by the session creation.
+	conn.openStream()
+	conn.openStream()
+	select {
+	case req := <-restart:
+		if req.Restart != "true" || req.To != "example.com" || req.Inner != "" {
+			t.Errorf("unexpected restart request %+v", req)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no restart request")
+	}
+}
+
+func TestBOSHTerminated(t *testing.T) {
+	cm := newFakeCM(t, func(r *http.Request, req *boshRequest) string {
+		if req.Sid == "" {
+			return boshFeatures
+		}
+		return "<body xmlns='http://jabber.org/protocol/httpbind' type='terminate' condition='remote-stream-error'/>"
+	})
+	defer cm.Close()
+
+	conn, _, err := newBOSH(context.Background(), cm.Client(), cm.URL, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := newXMLStream(conn, nil, true)
+	if _, err := s.ReadElement(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Write([]byte("<presence xmlns='jabber:client'/>"))
+	if _, err := s.ReadElement(); err == nil || !strings.Contains(err.Error(), "remote-stream-error") {
+		t.Errorf("got error %v, want the session terminated", err)
+	}
+}
+
+// TestBOSHCloseCancels checks that Close does not wait for the pending poll.
+func TestBOSHCloseCancels(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	polling := make(chan struct{}, 1)
+	canceled := make(chan struct{}, 1)
+	cm := newFakeCM(t, func(r *http.Request, req *boshRequest) string {
+		switch {
+		case req.Sid == "":
+			return boshFeatures
+		case req.Type == "terminate":
+			return "<body xmlns='http://jabber.org/protocol/httpbind' type='terminate'/>"
+		case req.poll():
+			polling <- struct{}{}
+			select {
+			case <-stop:
+			case <-r.Context().Done():
+				canceled <- struct{}{}
+			}
+		}
+		return boshEmpty
+	})
+	defer cm.Close()
+
+	conn, _, err := newBOSH(context.Background(), cm.Client(), cm.URL, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.openStream()
+	<-polling
+	conn.Close()
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Error("the poll is not canceled by Close")
+	}
+}
@@ -0,0 +1,160 @@
+// compress
+package client
+
+import (
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/ginuerzh/goxmpp/core"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// compressor is implemented by the transports able to compress the stream (XEP-0138).
+type compressor interface {
+	// Compress compresses the connection with zlib, once the server sent <compressed/>.
+	Compress() error
+	CompressionStats() (CompressionStats, bool)
+}
+
+// CompressionStats counts the bytes of a compressed stream.
+type CompressionStats struct {
+	// BytesIn and BytesOut are the compressed bytes read and written on the connection.
+	BytesIn, BytesOut int64
+	// RawIn and RawOut are the bytes of the stream before compression.
+	RawIn, RawOut int64
+}
+
+// Ratio returns the compressed size of the stream relative to its raw size,
+// both directions included: 0.25 means that compression saved 75% of the traffic.
+func (s CompressionStats) Ratio() float64 {
+	return ratio(s.BytesIn+s.BytesOut, s.RawIn+s.RawOut)
+}
+
+// InRatio returns the compressed size of the received stream relative to its raw size.
+func (s CompressionStats) InRatio() float64 {
+	return ratio(s.BytesIn, s.RawIn)
+}
+
+// OutRatio returns the compressed size of the sent stream relative to its raw size.
+func (s CompressionStats) OutRatio() float64 {
+	return ratio(s.BytesOut, s.RawOut)
+}
+
+func ratio(compressed, raw int64) float64 {
+	if raw == 0 {
+		return 1
+	}
+	return float64(compressed) / float64(raw)
+}
+
+// CompressionStats returns the statistics of the compression of the stream.
+// The bool is false if the stream is not compressed.
+func (c *Client) CompressionStats() (CompressionStats, bool) {
+	if t, ok := c.currentTransport().(compressor); ok {
+		return t.CompressionStats()
+	}
+	return CompressionStats{}, false
+}
+
+// compress negotiates the zlib compression of the stream, if enabled and offered
+// by the server, and restarts the stream. The stream stays uncompressed if the
+// server fails to set it up.
+func (c *Client) compress(features *core.StreamFeatures) (*core.StreamFeatures, error) {
+	t, ok := c.transport.(compressor)
+	if !c.Opts.Compression || !ok || features.Compress == nil || !contains(features.Compress.Method, "zlib") {
+		return features, nil
+	}
+
+	e, err := c.request(&core.Compress{Method: "zlib"})
+	if err != nil {
+		return nil, err
+	}
+	switch v := e.(type) {
+	case *core.Compressed:
+	case *core.CompressFailure:
+		if c.Opts.Debug {
+			fmt.Println(v)
+		}
+		return features, nil
+	default:
+		return nil, errors.New("compress: unexpected <" + e.Name() + ">")
+	}
+
+	if err := t.Compress(); err != nil {
+		return nil, err
+	}
+	return c.restartStream()
+}
+
+// countingConn counts the bytes read and written on a connection.
+type countingConn struct {
+	net.Conn
+	in, out int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.in, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.out, int64(n))
+	return n, err
+}
+
+// compressConn is a zlib compressed connection, flushing each write so that
+// every element reaches the server at once.
+type compressConn struct {
+	*countingConn
+	r     io.ReadCloser
+	wlock sync.Mutex
+	w     *zlib.Writer
+
+	rawIn, rawOut int64
+}
+
+func newCompressConn(conn net.Conn) *compressConn {
+	c := &compressConn{countingConn: &countingConn{Conn: conn}}
+	c.w = zlib.NewWriter(c.countingConn)
+	return c
+}
+
+func (c *compressConn) Read(p []byte) (int, error) {
+	// the zlib header is only read once the server sends something.
+	if c.r == nil {
+		r, err := zlib.NewReader(c.countingConn)
+		if err != nil {
+			return 0, err
+		}
+		c.r = r
+	}
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.rawIn, int64(n))
+	return n, err
+}
+
+func (c *compressConn) Write(p []byte) (int, error) {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.rawOut, int64(n))
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
+
+func (c *compressConn) Stats() CompressionStats {
+	return CompressionStats{
+		BytesIn:  atomic.LoadInt64(&c.in),
+		BytesOut: atomic.LoadInt64(&c.out),
+		RawIn:    atomic.LoadInt64(&c.rawIn),
+		RawOut:   atomic.LoadInt64(&c.rawOut),
+	}
+}
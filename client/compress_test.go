@@ -0,0 +1,91 @@
+// compress test
+package client
+
+import (
+	"compress/zlib"
+	xmpp "github.com/ginuerzh/goxmpp"
+	"github.com/ginuerzh/goxmpp/xep"
+	"io"
+	"net"
+	"testing"
+)
+
+// zlibConn is the server end of a compressed connection.
+type zlibConn struct {
+	net.Conn
+	r io.Reader
+	w *zlib.Writer
+}
+
+func (c *zlibConn) Read(p []byte) (int, error) {
+	if c.r == nil {
+		r, err := zlib.NewReader(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		c.r = r
+	}
+	return c.r.Read(p)
+}
+
+func (c *zlibConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
+
+// TestCompression negotiates compression after authentication: the rest of the
+// stream is compressed with zlib both ways.
+func TestCompression(t *testing.T) {
+	c := newFakeClient(t, &Options{Compression: true}, func(s *fakeServer) error {
+		if err := s.auth("<compression xmlns='http://jabber.org/features/compress'>" +
+			"<method>zlib</method></compression>"); err != nil {
+			return err
+		}
+		if _, err := s.expect("compress"); err != nil {
+			return err
+		}
+		if err := s.write("<compressed xmlns='http://jabber.org/protocol/compress'/>"); err != nil {
+			return err
+		}
+		s.conn = &zlibConn{Conn: s.conn, w: zlib.NewWriter(s.conn)}
+		if err := s.openStream("<bind xmlns='urn:ietf:params:xml:ns:xmpp-bind'/>"); err != nil {
+			return err
+		}
+		if err := s.bind("juliet@example.com/balcony"); err != nil {
+			return err
+		}
+		ping, err := s.expect("iq")
+		if err != nil {
+			return err
+		}
+		return s.write("<iq type='result' id='%s' from='example.com'/>", ping.attr("id"))
+	})
+	c.start()
+
+	if _, err := c.SendIQ(xmpp.NewIQ("get", "", "example.com", &xep.Ping{})); err != nil {
+		t.Fatal(err)
+	}
+	c.wait()
+	stats, ok := c.CompressionStats()
+	if !ok {
+		t.Fatal("the stream is not compressed")
+	}
+	if stats.BytesIn == 0 || stats.RawIn == 0 || stats.BytesOut == 0 || stats.RawOut == 0 {
+		t.Errorf("unexpected statistics %+v", stats)
+	}
+	c.stop()
+}
+
+// TestCompressionSASL2 fails to log in with compression when the server only
+// offers SASL2.
+func TestCompressionSASL2(t *testing.T) {
+	c := newFakeClient(t, &Options{Compression: true}, func(s *fakeServer) error {
+		return s.openStream("<authentication xmlns='urn:xmpp:sasl:2'><mechanism>PLAIN</mechanism></authentication>")
+	})
+	if err := c.Run(); err != ErrCompressionSASL2 {
+		t.Errorf("Run returned %v, want ErrCompressionSASL2", err)
+	}
+}
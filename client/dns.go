@@ -0,0 +1,151 @@
+// dns
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPort    = "5222"
+	defaultTLSPort = "5223"
+)
+
+var (
+	ErrServiceUnavailable = errors.New("xmpp: service decidedly not available at this domain")
+)
+
+// Resolver looks up the DNS SRV records used to find the host of an XMPP service.
+// *net.Resolver satisfies this interface.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// endpoint is a candidate address to connect to.
+type endpoint struct {
+	addr      string
+	directTLS bool
+}
+
+func (ep endpoint) String() string {
+	if ep.directTLS {
+		return "tls://" + ep.addr
+	}
+	return "tcp://" + ep.addr
+}
+
+// resolve returns the endpoints for domain in the order they should be tried.
+// The _xmpps-client._tcp records (XEP-0368) are merged with the _xmpp-client._tcp
+// records, the direct TLS one being preferred on equal priority. SecurityDirectTLS
+// only uses the former and SecurityNone only the latter.
+// If no SRV record is found, the domain itself on the default port is returned,
+// which is resolved by its A/AAAA records when dialing.
+func resolve(ctx context.Context, r Resolver, domain string, mode SecurityMode) ([]endpoint, error) {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	var secure, plain []*net.SRV
+	if mode != SecurityNone {
+		secure = lookupSRV(ctx, r, "xmpps-client", domain)
+	}
+	if mode != SecurityDirectTLS {
+		plain = lookupSRV(ctx, r, "xmpp-client", domain)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(err)
+	}
+	found := len(secure) > 0 || len(plain) > 0
+
+	var endpoints []endpoint
+	for len(secure) > 0 || len(plain) > 0 {
+		var srv *net.SRV
+		directTLS := false
+		if len(plain) == 0 || (len(secure) > 0 && secure[0].Priority <= plain[0].Priority) {
+			srv, secure, directTLS = secure[0], secure[1:], true
+		} else {
+			srv, plain = plain[0], plain[1:]
+		}
+		// A target of "." means the service is not offered by this record.
+		target := strings.TrimSuffix(srv.Target, ".")
+		if target == "" {
+			continue
+		}
+		endpoints = append(endpoints, endpoint{
+			addr:      net.JoinHostPort(target, strconv.Itoa(int(srv.Port))),
+			directTLS: directTLS,
+		})
+	}
+
+	if len(endpoints) == 0 {
+		if found {
+			return nil, ErrServiceUnavailable
+		}
+		if mode == SecurityDirectTLS {
+			endpoints = append(endpoints, endpoint{addr: net.JoinHostPort(domain, defaultTLSPort), directTLS: true})
+		} else {
+			endpoints = append(endpoints, endpoint{addr: net.JoinHostPort(domain, defaultPort)})
+		}
+	}
+	return endpoints, nil
+}
+
+func lookupSRV(ctx context.Context, r Resolver, service, domain string) []*net.SRV {
+	_, addrs, err := r.LookupSRV(ctx, service, "tcp", domain)
+	if err != nil {
+		return nil
+	}
+	return orderSRV(addrs)
+}
+
+// orderSRV sorts the records by priority and, within the same priority,
+// by the weighted random selection described in RFC 2782.
+func orderSRV(addrs []*net.SRV) []*net.SRV {
+	sorted := make([]*net.SRV, len(addrs))
+	copy(sorted, addrs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		// zero weight records go first so that they have a small chance of being chosen.
+		return sorted[i].Weight == 0 && sorted[j].Weight != 0
+	})
+
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j].Priority == sorted[i].Priority {
+			j++
+		}
+		shuffleByWeight(sorted[i:j])
+		i = j
+	}
+	return sorted
+}
+
+func shuffleByWeight(addrs []*net.SRV) {
+	sum := 0
+	for _, addr := range addrs {
+		sum += int(addr.Weight)
+	}
+	for len(addrs) > 1 {
+		n := 0
+		if sum > 0 {
+			n = rand.Intn(sum + 1)
+		}
+		i := 0
+		for ; i < len(addrs)-1; i++ {
+			n -= int(addrs[i].Weight)
+			if n <= 0 {
+				break
+			}
+		}
+		addrs[0], addrs[i] = addrs[i], addrs[0]
+		sum -= int(addrs[0].Weight)
+		addrs = addrs[1:]
+	}
+}
@@ -0,0 +1,136 @@
+// dns test
+package client
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// fakeResolver answers the SRV lookups from a table indexed by "_service._proto.name".
+type fakeResolver map[string][]*net.SRV
+
+func (r fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	key := "_" + service + "._" + proto + "." + name
+	addrs, ok := r[key]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: key, IsNotFound: true}
+	}
+	return key, addrs, nil
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		records   fakeResolver
+		mode      SecurityMode
+		endpoints []string
+		err       error
+	}{
+		{
+			name: "priority",
+			records: fakeResolver{"_xmpp-client._tcp.example.com": {
+				{Target: "c.example.com.", Port: 5222, Priority: 30},
+				{Target: "a.example.com.", Port: 5222, Priority: 10},
+				{Target: "b.example.com.", Port: 5269, Priority: 20},
+			}},
+			endpoints: []string{"tcp://a.example.com:5222", "tcp://b.example.com:5269", "tcp://c.example.com:5222"},
+		},
+		{
+			name: "no service",
+			records: fakeResolver{"_xmpp-client._tcp.example.com": {
+				{Target: ".", Port: 0},
+			}},
+			err: ErrServiceUnavailable,
+		},
+		{
+			name: "merged direct TLS",
+			records: fakeResolver{
+				"_xmpp-client._tcp.example.com": {
+					{Target: "plain0.example.com.", Port: 5222, Priority: 0},
+					{Target: "plain1.example.com.", Port: 5222, Priority: 1},
+				},
+				"_xmpps-client._tcp.example.com": {
+					{Target: "tls1.example.com.", Port: 443, Priority: 1},
+					{Target: "tls2.example.com.", Port: 5223, Priority: 2},
+				},
+			},
+			endpoints: []string{"tcp://plain0.example.com:5222", "tls://tls1.example.com:443",
+				"tcp://plain1.example.com:5222", "tls://tls2.example.com:5223"},
+		},
+		{
+			name: "direct TLS only",
+			records: fakeResolver{
+				"_xmpp-client._tcp.example.com":  {{Target: "plain.example.com.", Port: 5222}},
+				"_xmpps-client._tcp.example.com": {{Target: "tls.example.com.", Port: 443}},
+			},
+			mode:      SecurityDirectTLS,
+			endpoints: []string{"tls://tls.example.com:443"},
+		},
+		{
+			name: "no TLS",
+			records: fakeResolver{
+				"_xmpp-client._tcp.example.com":  {{Target: "plain.example.com.", Port: 5222}},
+				"_xmpps-client._tcp.example.com": {{Target: "tls.example.com.", Port: 443}},
+			},
+			mode:      SecurityNone,
+			endpoints: []string{"tcp://plain.example.com:5222"},
+		},
+		{
+			name:      "fallback",
+			records:   fakeResolver{},
+			endpoints: []string{"tcp://example.com:5222"},
+		},
+		{
+			name:      "fallback direct TLS",
+			records:   fakeResolver{},
+			mode:      SecurityDirectTLS,
+			endpoints: []string{"tls://example.com:5223"},
+		},
+	}
+
+	for _, tt := range tests {
+		endpoints, err := resolve(context.Background(), tt.records, "example.com", tt.mode)
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		var got []string
+		for _, ep := range endpoints {
+			got = append(got, ep.String())
+		}
+		if !reflect.DeepEqual(got, tt.endpoints) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.endpoints)
+		}
+	}
+}
+
+func TestOrderSRVWeight(t *testing.T) {
+	addrs := []*net.SRV{
+		{Target: "light", Priority: 1, Weight: 10},
+		{Target: "heavy", Priority: 1, Weight: 90},
+		{Target: "zero", Priority: 1, Weight: 0},
+		{Target: "backup", Priority: 2, Weight: 100},
+	}
+
+	first := map[string]int{}
+	const n = 10000
+	for i := 0; i < n; i++ {
+		sorted := orderSRV(addrs)
+		if len(sorted) != len(addrs) {
+			t.Fatalf("got %d records, want %d", len(sorted), len(addrs))
+		}
+		if sorted[3].Target != "backup" {
+			t.Fatalf("got %s last, want the record of lower priority", sorted[3].Target)
+		}
+		first[sorted[0].Target]++
+	}
+
+	// the first record is chosen with a probability of weight/(sum+1).
+	for target, want := range map[string]float64{"heavy": 0.89, "light": 0.099, "zero": 0.0099} {
+		if got := float64(first[target]) / n; got < want*0.8-0.002 || got > want*1.2+0.002 {
+			t.Errorf("%s first %.3f of the time, want about %.3f", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// fast
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/ginuerzh/goxmpp/core"
+	"time"
+)
+
+// FastToken is a token issued by the server to authenticate quickly on the
+// next logins (XEP-0484).
+type FastToken struct {
+	// Mechanism is the HT-* mechanism the token is to be used with.
+	Mechanism string
+	Token     string
+	Expiry    time.Time
+}
+
+// FastTokenStore keeps the FAST tokens across logins, usually in persistent storage.
+// Tokens are secrets and should be stored as carefully as passwords.
+type FastTokenStore interface {
+	// LoadToken returns the token stored for the bare JID, or nil if there is none.
+	LoadToken(jid string) (*FastToken, error)
+	// StoreToken stores the token for the bare JID. A nil token deletes the stored one.
+	StoreToken(jid string, token *FastToken) error
+}
+
+// htMechanisms maps the HT mechanisms to the channel binding type they use.
+var htMechanisms = map[string]string{
+	"HT-SHA-256-EXPR": "tls-exporter",
+	"HT-SHA-256-UNIQ": "tls-unique",
+	"HT-SHA-256-NONE": "",
+}
+
+func init() {
+	for name, cbType := range htMechanisms {
+		name, cbType := name, cbType
+		RegisterMechanism(name, func() Mechanism { return &htAuth{name: name, cbType: cbType} })
+	}
+}
+
+// HT-SHA-256-* (draft-schmaus-kitten-sasl-ht), authenticating with a FAST token.
+type htAuth struct {
+	name   string
+	cbType string
+	token  []byte
+	cbData []byte
+}
+
+func (a *htAuth) Name() string {
+	return a.name
+}
+
+func (a *htAuth) Start(info *SaslInfo) ([]byte, error) {
+	if info.FastToken == "" || info.User == "" {
+		return nil, ErrMechanismUnavailable
+	}
+	if a.cbType != "" {
+		cbType, cbData := channelBinding(info.TLS, []string{a.cbType})
+		if cbType == "" {
+			return nil, ErrMechanismUnavailable
+		}
+		a.cbData = cbData
+	}
+	a.token = []byte(info.FastToken)
+
+	return append([]byte(info.User+"\x00"), a.hmac("Initiator")...), nil
+}
+
+func (a *htAuth) Next(data []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("sasl: unexpected challenge for " + a.name)
+	}
+	if !hmac.Equal(data, a.hmac("Responder")) {
+		return nil, errors.New("sasl: " + a.name + " server verification mismatch")
+	}
+	return nil, nil
+}
+
+func (a *htAuth) hmac(label string) []byte {
+	mac := hmac.New(sha256.New, a.token)
+	mac.Write([]byte(label))
+	mac.Write(a.cbData)
+	return mac.Sum(nil)
+}
+
+// fastFeature returns the FAST feature if the client can use it.
+func (c *Client) fastFeature(auth *core.Sasl2Authentication) *core.Fast {
+	if c.Opts.FastTokenStore == nil || c.Opts.UserAgent == nil || c.Opts.UserAgent.Id == "" ||
+		auth.Inline == nil || auth.Inline.Fast == nil {
+		return nil
+	}
+	return auth.Inline.Fast
+}
+
+// fastAuthenticate authenticates with the stored token, if any. It returns a nil
+// success without error if the token is missing, unusable on this connection,
+// or rejected, so that the caller falls back to another mechanism. The token is
+// only deleted if it is expired or rejected.
+// The token is sent in the first SASL2 round trip; TLS 0-RTT early data is not
+// used as crypto/tls does not support it.
+func (c *Client) fastAuthenticate(fast *core.Fast, info *SaslInfo, req *core.Sasl2Authenticate) (*core.Sasl2Success, error) {
+	if info.User == "" {
+		return nil, nil
+	}
+	jid := info.User + "@" + info.Domain
+	token, err := c.Opts.FastTokenStore.LoadToken(jid)
+	if err != nil || token == nil {
+		return nil, err
+	}
+	want, ok := htMechanisms[token.Mechanism]
+	if !ok || (!token.Expiry.IsZero() && token.Expiry.Before(time.Now())) {
+		return nil, c.Opts.FastTokenStore.StoreToken(jid, nil)
+	}
+	// the token stays valid for the connections that support its channel binding.
+	if cbType, _ := channelBinding(info.TLS, []string{want}); cbType != want ||
+		!contains(fast.Mechanism, token.Mechanism) {
+		if c.Opts.Debug {
+			fmt.Println("FAST token not usable on this connection:", token.Mechanism)
+		}
+		return nil, nil
+	}
+
+	fastInfo := *info
+	fastInfo.FastToken = token.Token
+	fastInfo.Mechanisms = fast.Mechanism
+
+	req.Fast = &core.Fast{}
+	success, err := c.authenticate2([]string{token.Mechanism}, &fastInfo, req)
+	if err == nil {
+		if success.Token != nil {
+			err = c.storeToken(info, token.Mechanism, success.Token)
+		}
+		return success, err
+	}
+	if _, ok := err.(*core.Sasl2Failure); ok {
+		if c.Opts.Debug {
+			fmt.Println("FAST token rejected:", err)
+		}
+		return nil, c.Opts.FastTokenStore.StoreToken(jid, nil)
+	}
+	return nil, err
+}
+
+// requestToken returns the request for a new token with the strongest HT mechanism
+// usable on this connection.
+func requestToken(fast *core.Fast, info *SaslInfo) *core.FastRequestToken {
+	if fast == nil || info.User == "" {
+		return nil
+	}
+
+	cbType, _ := channelBinding(info.TLS, info.ChannelBindings)
+	for _, name := range []string{"HT-SHA-256-EXPR", "HT-SHA-256-UNIQ", "HT-SHA-256-NONE"} {
+		if contains(fast.Mechanism, name) && (htMechanisms[name] == "" || htMechanisms[name] == cbType) {
+			return &core.FastRequestToken{Mechanism: name}
+		}
+	}
+	return nil
+}
+
+// storeToken saves the token sent by the server on success.
+func (c *Client) storeToken(info *SaslInfo, mechanism string, t *core.FastToken) error {
+	token := &FastToken{Mechanism: mechanism, Token: t.Token}
+	if expiry, err := time.Parse(time.RFC3339, t.Expiry); err == nil {
+		token.Expiry = expiry
+	}
+	return c.Opts.FastTokenStore.StoreToken(info.User+"@"+info.Domain, token)
+}
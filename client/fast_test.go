@@ -0,0 +1,112 @@
+// fast test
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/ginuerzh/goxmpp/core"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeTokenStore keeps the tokens in memory.
+type fakeTokenStore struct {
+	tokens map[string]*FastToken
+	lock   sync.Mutex
+}
+
+func (s *fakeTokenStore) LoadToken(jid string) (*FastToken, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.tokens[jid], nil
+}
+
+func (s *fakeTokenStore) StoreToken(jid string, token *FastToken) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if token == nil {
+		delete(s.tokens, jid)
+	} else {
+		s.tokens[jid] = token
+	}
+	return nil
+}
+
+// TestFastChannelBinding logs in without TLS with a token bound to it: the token
+// is not used, and kept for the next logins over TLS.
+func TestFastChannelBinding(t *testing.T) {
+	token := &FastToken{Mechanism: "HT-SHA-256-EXPR", Token: "s3cr3t"}
+	store := &fakeTokenStore{tokens: map[string]*FastToken{"juliet@example.com": token}}
+	c := newFakeClient(t, &Options{
+		UserAgent:      &core.UserAgent{Id: "d4565fa7-4d72-4749-b3d3-740edbf87770"},
+		FastTokenStore: store,
+	}, func(s *fakeServer) error {
+		if err := s.openStream("<authentication xmlns='urn:xmpp:sasl:2'><mechanism>PLAIN</mechanism>" +
+			"<inline><fast xmlns='urn:xmpp:fast:0'><mechanism>HT-SHA-256-EXPR</mechanism></fast>" +
+			"</inline></authentication>"); err != nil {
+			return err
+		}
+		if _, err := s.expect("authenticate"); err != nil {
+			return err
+		}
+		if err := s.write("<success xmlns='urn:xmpp:sasl:2'>" +
+			"<authorization-identifier>juliet@example.com</authorization-identifier></success>"); err != nil {
+			return err
+		}
+		return s.bind("juliet@example.com/balcony")
+	})
+	c.start()
+
+	c.login()
+	c.wait()
+	if got, _ := store.LoadToken("juliet@example.com"); got != token {
+		t.Errorf("stored token %v, want %v", got, token)
+	}
+	c.stop()
+}
+
+// TestFastToken logs in with the stored token when the server offers FAST
+// without Bind 2, along with SASL.
+func TestFastToken(t *testing.T) {
+	mac := func(label string) []byte {
+		h := hmac.New(sha256.New, []byte("s3cr3t"))
+		h.Write([]byte(label))
+		return h.Sum(nil)
+	}
+	store := &fakeTokenStore{tokens: map[string]*FastToken{
+		"juliet@example.com": {Mechanism: "HT-SHA-256-NONE", Token: "s3cr3t"},
+	}}
+	c := newFakeClient(t, &Options{
+		UserAgent:      &core.UserAgent{Id: "d4565fa7-4d72-4749-b3d3-740edbf87770"},
+		FastTokenStore: store,
+	}, func(s *fakeServer) error {
+		if err := s.openStream("<mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'><mechanism>PLAIN</mechanism></mechanisms>" +
+			"<authentication xmlns='urn:xmpp:sasl:2'><mechanism>PLAIN</mechanism>" +
+			"<inline><fast xmlns='urn:xmpp:fast:0'><mechanism>HT-SHA-256-NONE</mechanism></fast>" +
+			"</inline></authentication>"); err != nil {
+			return err
+		}
+		auth, err := s.expect("authenticate")
+		if err != nil {
+			return err
+		}
+		ir := base64.StdEncoding.EncodeToString(append([]byte("juliet\x00"), mac("Initiator")...))
+		if auth.attr("mechanism") != "HT-SHA-256-NONE" || !strings.Contains(auth.Inner, ir) {
+			return errors.New("unexpected authentication with " + auth.attr("mechanism") + ": " + auth.Inner)
+		}
+		if err := s.write("<success xmlns='urn:xmpp:sasl:2'><additional-data>%s</additional-data>"+
+			"<authorization-identifier>juliet@example.com</authorization-identifier></success>",
+			base64.StdEncoding.EncodeToString(mac("Responder"))); err != nil {
+			return err
+		}
+		return s.bind("juliet@example.com/balcony")
+	})
+	c.start()
+
+	c.login()
+	c.wait()
+	c.stop()
+}
@@ -0,0 +1,109 @@
+// hostmeta
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+// XEP-0156: Discovering Alternative XMPP Connection Methods
+const (
+	relWebSocket = "urn:xmpp:alt-connections:websocket"
+	relBOSH      = "urn:xmpp:alt-connections:xbosh"
+)
+
+type hostMeta struct {
+	Links []hostMetaLink `xml:"Link" json:"links"`
+}
+
+type hostMetaLink struct {
+	Rel  string `xml:"rel,attr" json:"rel"`
+	Href string `xml:"href,attr" json:"href"`
+}
+
+// lookupHostMeta returns the URLs of the connection method rel announced in the
+// host-meta of the domain, trying the JSON document first, then the XRD one.
+func lookupHostMeta(ctx context.Context, client *http.Client, domain, rel string) ([]string, error) {
+	meta, err := fetchHostMeta(ctx, client, "https://"+domain+"/.well-known/host-meta.json", json.Unmarshal)
+	if err != nil {
+		meta, err = fetchHostMeta(ctx, client, "https://"+domain+"/.well-known/host-meta", xml.Unmarshal)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, link := range meta.Links {
+		if link.Rel == rel && link.Href != "" {
+			urls = append(urls, link.Href)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("xmpp: no " + rel + " endpoint in the host-meta of " + domain)
+	}
+	return urls, nil
+}
+
+func fetchHostMeta(ctx context.Context, client *http.Client, rawurl string,
+	unmarshal func([]byte, interface{}) error) (*hostMeta, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("host-meta: " + rawurl + ": " + resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &hostMeta{}
+	if err := unmarshal(b, meta); err != nil {
+		return nil, errors.New("host-meta: " + rawurl + ": " + err.Error())
+	}
+	return meta, nil
+}
+
+// httpClient returns the HTTP client used for discovery and BOSH, connecting
+// through the proxy like the other transports. The same client is used for all
+// the connections, keeping the idle ones until Close.
+func (c *Client) httpClient() *http.Client {
+	c.httpLock.Lock()
+	defer c.httpLock.Unlock()
+	if c.http != nil {
+		return c.http
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return c.connect(ctx, addr)
+		},
+	}
+	if c.Opts.TlsConfig != nil {
+		transport.TLSClientConfig = c.Opts.TlsConfig.Clone()
+		transport.TLSClientConfig.ServerName = ""
+	}
+	c.http = &http.Client{Transport: transport}
+	return c.http
+}
+
+func (c *Client) closeIdleConnections() {
+	c.httpLock.Lock()
+	defer c.httpLock.Unlock()
+	if c.http != nil {
+		c.http.CloseIdleConnections()
+	}
+}
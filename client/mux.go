@@ -0,0 +1,315 @@
+// mux
+package client
+
+import (
+	"context"
+	"errors"
+	xmpp "github.com/ginuerzh/goxmpp"
+	"github.com/ginuerzh/goxmpp/core"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrReplied is returned when replying again to an IQ request.
+var ErrReplied = errors.New("xmpp: IQ already replied")
+
+// StanzaHandler handles the stanzas received, replying with w.
+type StanzaHandler interface {
+	HandleStanza(w ReplyWriter, st *xmpp.Stanza)
+}
+
+// StanzaHandlerFunc is a function used as a StanzaHandler.
+type StanzaHandlerFunc func(w ReplyWriter, st *xmpp.Stanza)
+
+func (f StanzaHandlerFunc) HandleStanza(w ReplyWriter, st *xmpp.Stanza) {
+	f(w, st)
+}
+
+// IQHandlerFunc handles an IQ get or set. The element returned is the payload
+// of the result, the error is replied as a stanza error: a *core.StanzaError or
+// a core.StanzaCondition, internal-server-error otherwise.
+type IQHandlerFunc func(iq *xmpp.Stanza) (xmpp.Element, error)
+
+func (f IQHandlerFunc) HandleStanza(w ReplyWriter, st *xmpp.Stanza) {
+	if !isRequest(st) {
+		return
+	}
+	payload, err := f(st)
+	switch {
+	case err != nil:
+		w.Error(stanzaError(err))
+	case payload != nil:
+		w.Reply(payload)
+	default:
+		w.Reply()
+	}
+}
+
+// stanzaError returns the stanza error replied for err.
+func stanzaError(err error) *core.StanzaError {
+	var e *core.StanzaError
+	if errors.As(err, &e) {
+		return e
+	}
+	var cond core.StanzaCondition
+	if errors.As(err, &cond) {
+		return core.NewStanzaError(cond, "")
+	}
+	return core.NewStanzaError(core.StanzaInternalServerError, "")
+}
+
+// isRequest reports whether the stanza is an IQ get or set, which must be replied.
+func isRequest(st *xmpp.Stanza) bool {
+	return st.Name() == "iq" && (st.Types == "get" || st.Types == "set")
+}
+
+// isReply reports whether st is the result or the error of the IQ request.
+func isReply(req *xmpp.Stanza, st xmpp.Stan) bool {
+	return isRequest(req) && st.Name() == "iq" && st.Id() == req.Id() &&
+		(st.Type() == "result" || st.Type() == "error")
+}
+
+// Middleware wraps a handler, to log, filter or limit the stanzas it handles.
+type Middleware func(StanzaHandler) StanzaHandler
+
+// ReplyWriter replies to the stanza being handled. An IQ get or set is replied
+// once, the next replies return ErrReplied. The handler must reply before it
+// returns: a request left unreplied is answered with an error, and the replies
+// sent later return ErrReplied.
+type ReplyWriter interface {
+	// Reply sends a stanza of the same kind with the payload to the sender:
+	// a result with the same id for an IQ.
+	Reply(payload ...xmpp.Element) error
+	// Error sends the error reply (RFC 6120 8.3.1).
+	Error(err *core.StanzaError) error
+	// Send sends any stanza. An IQ result or error with the id of the request
+	// counts as its reply.
+	Send(st xmpp.Stan) error
+}
+
+// Match selects the stanzas routed to a handler. The empty fields match anything.
+type Match struct {
+	// Kind is the name of the stanza: "iq", "message" or "presence".
+	Kind string
+	// Type is the type of the stanza, like "get" or "chat".
+	Type string
+	// Payload is the namespace and the local name of a child element,
+	// like "urn:xmpp:ping ping", or the namespace alone.
+	Payload string
+	// From is the JID of the sender, a bare JID matching all its resources.
+	// '*' matches any sequence of characters, like in "*@example.com".
+	From string
+}
+
+func (m Match) match(st *xmpp.Stanza) bool {
+	switch {
+	case m.Kind != "" && m.Kind != st.Name():
+		return false
+	case m.Type != "" && m.Type != st.Type():
+		return false
+	case m.Payload != "" && payload(st, m.Payload) == nil:
+		return false
+	case m.From != "" && !matchJID(m.From, st.From):
+		return false
+	}
+	return true
+}
+
+// payload returns the first element of the stanza with the name, or the namespace.
+func payload(st *xmpp.Stanza, name string) xmpp.Element {
+	for _, e := range st.E() {
+		full := e.FullName()
+		if full == name || strings.HasPrefix(full, name+" ") {
+			return e
+		}
+	}
+	return nil
+}
+
+// matchJID reports whether the sender matches the pattern of Match.From.
+func matchJID(pattern, from string) bool {
+	jid := xmpp.ToJID(from)
+	s := jid.String()
+	if !strings.Contains(pattern, "/") {
+		s = jid.Bare()
+	}
+	if strings.Contains(pattern, "*") {
+		return wildcard(pattern, s)
+	}
+	return xmpp.ToJID(pattern).String() == s
+}
+
+// wildcard matches s against a pattern where '*' matches any sequence.
+func wildcard(pattern, s string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, pattern[:star]) {
+		return false
+	}
+	pattern, s = pattern[star+1:], s[star:]
+	for i := 0; i <= len(s); i++ {
+		if wildcard(pattern, s[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+type route struct {
+	match   Match
+	handler StanzaHandler
+}
+
+// Mux routes the stanzas to the first handler registered with a matching Match.
+// It is safe to register handlers and middleware while stanzas are being handled.
+type Mux struct {
+	lock       sync.RWMutex
+	routes     []route
+	middleware []Middleware
+}
+
+func NewMux() *Mux {
+	return &Mux{}
+}
+
+// Handle registers the handler for the stanzas that match m.
+func (mux *Mux) Handle(m Match, h StanzaHandler) {
+	mux.lock.Lock()
+	defer mux.lock.Unlock()
+	mux.routes = append(mux.routes, route{match: m, handler: h})
+}
+
+func (mux *Mux) HandleFunc(m Match, f StanzaHandlerFunc) {
+	mux.Handle(m, f)
+}
+
+// HandleIQ registers the handler for the IQ requests that match m.
+func (mux *Mux) HandleIQ(m Match, f IQHandlerFunc) {
+	m.Kind = "iq"
+	mux.Handle(m, f)
+}
+
+// Use adds middleware wrapping all the handlers, the first one added outermost.
+func (mux *Mux) Use(mw ...Middleware) {
+	mux.lock.Lock()
+	defer mux.lock.Unlock()
+	mux.middleware = append(mux.middleware, mw...)
+}
+
+// Handler returns the handler of the stanza, wrapped by the middleware, nil if none.
+func (mux *Mux) Handler(st *xmpp.Stanza) StanzaHandler {
+	mux.lock.RLock()
+	defer mux.lock.RUnlock()
+
+	for _, r := range mux.routes {
+		if r.match.match(st) {
+			h := r.handler
+			for i := len(mux.middleware) - 1; i >= 0; i-- {
+				h = mux.middleware[i](h)
+			}
+			return h
+		}
+	}
+	return nil
+}
+
+func (mux *Mux) HandleStanza(w ReplyWriter, st *xmpp.Stanza) {
+	if h := mux.Handler(st); h != nil {
+		h.HandleStanza(w, st)
+	}
+}
+
+// replyWriter replies to a stanza received by the client. While an IQ request
+// is handled, it is kept by the client so that the replies sent with Client.Send
+// are counted too.
+type replyWriter struct {
+	c       *Client
+	st      *xmpp.Stanza
+	replied int32
+}
+
+// sendContext sends the stanza, once for the reply to an IQ request.
+func (w *replyWriter) sendContext(ctx context.Context, st xmpp.Stan) error {
+	if isReply(w.st, st) && !atomic.CompareAndSwapInt32(&w.replied, 0, 1) {
+		return ErrReplied
+	}
+	return w.c.sendContext(ctx, st)
+}
+
+func (w *replyWriter) Reply(payload ...xmpp.Element) error {
+	reply := xmpp.NewStanza(w.st.Name(), payload...)
+	reply.To = w.st.From
+	if w.st.Name() == "iq" {
+		reply.Types = "result"
+		reply.Ids = w.st.Ids
+	}
+	return w.Send(reply)
+}
+
+func (w *replyWriter) Error(err *core.StanzaError) error {
+	return w.Send(xmpp.NewErrorReply(w.st, err))
+}
+
+func (w *replyWriter) Send(st xmpp.Stan) error {
+	return w.sendContext(context.Background(), st)
+}
+
+// replyKey identifies an IQ request by its sender and its id, which are the
+// recipient and the id of its reply.
+func replyKey(jid, id string) string {
+	return jid + " " + id
+}
+
+func (c *Client) addReply(w *replyWriter) {
+	c.repliesLock.Lock()
+	defer c.repliesLock.Unlock()
+	c.replies[replyKey(w.st.From, w.st.Ids)] = w
+}
+
+func (c *Client) removeReply(w *replyWriter) {
+	c.repliesLock.Lock()
+	defer c.repliesLock.Unlock()
+	key := replyKey(w.st.From, w.st.Ids)
+	if c.replies[key] == w {
+		delete(c.replies, key)
+	}
+}
+
+// pendingReply returns the writer of the IQ request being handled that st
+// replies to, nil if none.
+func (c *Client) pendingReply(st xmpp.Stan) *replyWriter {
+	reply, ok := st.(*xmpp.Stanza)
+	if !ok || reply.Name() != "iq" {
+		return nil
+	}
+	c.repliesLock.Lock()
+	defer c.repliesLock.Unlock()
+	w := c.replies[replyKey(reply.To, reply.Ids)]
+	if w == nil || !isReply(w.st, reply) {
+		return nil
+	}
+	return w
+}
+
+// Handle registers the handler for the stanzas that match m, see Mux.
+func (c *Client) Handle(m Match, h StanzaHandler) {
+	c.mux.Handle(m, h)
+}
+
+func (c *Client) HandleStanzaFunc(m Match, f StanzaHandlerFunc) {
+	c.mux.Handle(m, f)
+}
+
+// HandleIQ registers the handler for the IQ requests that match m.
+// The requests that no handler replies get the error of Options.UnhandledIQ.
+func (c *Client) HandleIQ(m Match, f IQHandlerFunc) {
+	c.mux.HandleIQ(m, f)
+}
+
+// Use adds middleware wrapping all the handlers, see Mux.Use.
+func (c *Client) Use(mw ...Middleware) {
+	c.mux.Use(mw...)
+}
@@ -0,0 +1,89 @@
+// mux test
+package client
+
+import (
+	"errors"
+	xmpp "github.com/ginuerzh/goxmpp"
+	"github.com/ginuerzh/goxmpp/core"
+	"strings"
+	"testing"
+)
+
+// TestUnhandledIQ checks that each IQ request gets exactly one reply: the one
+// sent with Send by its handlers, or the error of Options.UnhandledIQ if they
+// return without replying.
+func TestUnhandledIQ(t *testing.T) {
+	replied := make(chan struct{})
+	c := newFakeClient(t, &Options{UnhandledIQ: core.StanzaFeatureNotImplemented}, func(s *fakeServer) error {
+		if err := s.login("juliet@example.com/balcony"); err != nil {
+			return err
+		}
+		for _, req := range []struct{ id, payload, reply string }{
+			{"a", "<a xmlns='urn:example:a'/>", "result"},
+			{"b", "<b xmlns='urn:example:b'/>", "feature-not-implemented"},
+			{"c", "<c xmlns='urn:example:c'/>", "feature-not-implemented"},
+			{"d", "<d xmlns='urn:example:d'/>", "feature-not-implemented"},
+			{"e", "<e xmlns='urn:example:e'/>", "result"},
+		} {
+			if err := s.write("<iq type='get' id='%s' from='romeo@example.com/orchard'>%s</iq>",
+				req.id, req.payload); err != nil {
+				return err
+			}
+			iq, err := s.expect("iq")
+			if err != nil {
+				return err
+			}
+			if iq.attr("id") != req.id {
+				return errors.New("reply to " + iq.attr("id") + " instead of " + req.id)
+			}
+			if iq.attr("type") != req.reply && !strings.Contains(iq.Inner, "<"+req.reply) {
+				return errors.New("unexpected reply to " + req.id + ": " + iq.Inner)
+			}
+		}
+		close(replied)
+		// nothing else is sent until the stream is closed.
+		for {
+			e, err := s.read()
+			if err != nil {
+				return nil
+			}
+			if e.XMLName.Local == "iq" {
+				return errors.New("second reply to " + e.attr("id"))
+			}
+		}
+	})
+	c.HandleStanzaFunc(Match{Payload: "urn:example:a"}, func(w ReplyWriter, st *xmpp.Stanza) {
+		reply := xmpp.NewStanza("iq")
+		reply.Types, reply.Ids, reply.To = "result", st.Ids, st.From
+		w.Send(reply)
+	})
+	late := make(chan error, 1)
+	c.HandleStanzaFunc(Match{Payload: "urn:example:c"}, func(w ReplyWriter, st *xmpp.Stanza) {
+		go func() {
+			<-replied
+			late <- w.Reply()
+		}()
+	})
+	// the handlers of HandleFunc reply with Send, if at all.
+	c.HandleFunc("urn:example:d d", func(header *core.StanzaHeader, e xmpp.Element) {})
+	c.HandleFunc("urn:example:e e", func(header *core.StanzaHeader, e xmpp.Element) {
+		reply := xmpp.NewStanza("iq")
+		reply.Types, reply.Ids, reply.To = "result", header.Ids, header.From
+		c.Send(reply)
+	})
+	c.HandleIQ(Match{Payload: "urn:example:e"}, func(iq *xmpp.Stanza) (xmpp.Element, error) {
+		return nil, nil
+	})
+	c.start()
+
+	select {
+	case err := <-late:
+		if err != ErrReplied {
+			t.Errorf("late reply returned %v, want ErrReplied", err)
+		}
+	case err := <-c.done:
+		t.Fatal("server:", err)
+	}
+	c.stop()
+	c.wait()
+}
@@ -0,0 +1,90 @@
+// oauth
+package client
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// TokenFunc returns an OAuth 2.0 access token to authenticate with.
+type TokenFunc func() (string, error)
+
+// OAuthError is the error status sent by the server when OAUTHBEARER fails (RFC 7628 3.2.2).
+type OAuthError struct {
+	Status              string `json:"status"`
+	Scope               string `json:"scope,omitempty"`
+	OpenIDConfiguration string `json:"openid-configuration,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	s := "sasl: OAUTHBEARER " + e.Status
+	if e.Scope != "" {
+		s += " (scope: " + e.Scope + ")"
+	}
+	return s
+}
+
+// OAUTHBEARER (RFC 7628)
+type oauthBearerAuth struct {
+	err error
+}
+
+func (_ oauthBearerAuth) Name() string {
+	return "OAUTHBEARER"
+}
+
+func (a *oauthBearerAuth) Start(info *SaslInfo) ([]byte, error) {
+	if info.Token == "" {
+		return nil, ErrMechanismUnavailable
+	}
+
+	gs2Header := "n,,"
+	if info.Authzid != "" {
+		gs2Header = "n,a=" + scramName(info.Authzid) + ","
+	}
+	return []byte(gs2Header + "\x01host=" + info.Domain +
+		"\x01auth=Bearer " + info.Token + "\x01\x01"), nil
+}
+
+func (a *oauthBearerAuth) Next(data []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	if a.err != nil {
+		return nil, errors.New("sasl: unexpected challenge for OAUTHBEARER")
+	}
+
+	// The challenge is the error status, to which the client replies with a
+	// dummy response before the server sends the failure.
+	e := new(OAuthError)
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, errors.New("sasl: invalid OAUTHBEARER error status: " + err.Error())
+	}
+	a.err = e
+	return []byte{0x01}, nil
+}
+
+func (a *oauthBearerAuth) failure() error {
+	return a.err
+}
+
+// X-OAUTH2, the legacy token authentication of Google Talk.
+type xOAuth2Auth struct{}
+
+func (_ xOAuth2Auth) Name() string {
+	return "X-OAUTH2"
+}
+
+func (_ xOAuth2Auth) Start(info *SaslInfo) ([]byte, error) {
+	if info.Token == "" || info.User == "" {
+		return nil, ErrMechanismUnavailable
+	}
+	return []byte("\x00" + info.User + "@" + info.Domain + "\x00" + info.Token), nil
+}
+
+func (_ xOAuth2Auth) Next(data []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("sasl: unexpected challenge for X-OAUTH2")
+	}
+	return nil, nil
+}
@@ -0,0 +1,325 @@
+// proxy
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"golang.org/x/net/http/httpproxy"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrProxyAuth is returned when the proxy rejects the credentials of the proxy URL.
+var ErrProxyAuth = errors.New("proxy: authentication failed")
+
+// proxyURL returns the proxy to connect to addr through: the one of Options.Proxy,
+// or if empty of the HTTPS_PROXY or ALL_PROXY environment variables unless addr
+// matches NO_PROXY or is a loopback address, nil if none.
+func (c *Client) proxyURL(addr string) (*url.URL, error) {
+	if c.Opts.Proxy != "" {
+		return parseProxy(c.Opts.Proxy)
+	}
+
+	config := httpproxy.FromEnvironment()
+	for _, env := range []string{"ALL_PROXY", "all_proxy"} {
+		if config.HTTPSProxy == "" {
+			config.HTTPSProxy = os.Getenv(env)
+		}
+	}
+	proxy, err := config.ProxyFunc()(&url.URL{Scheme: "https", Host: addr})
+	if err != nil {
+		return nil, errors.New("proxy: invalid url: " + err.Error())
+	}
+	if proxy == nil {
+		return nil, nil
+	}
+	return parseProxy(proxy.String())
+}
+
+// parseProxy parses a proxy URL, "host:port" being an HTTP proxy.
+func parseProxy(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.New("proxy: invalid url: " + err.Error())
+	}
+
+	var port string
+	switch u.Scheme {
+	case "http":
+		port = "80"
+	case "socks5", "socks5h":
+		port = "1080"
+	case "https":
+		return nil, errors.New("proxy: TLS to the proxy is not supported, use an http:// proxy: " + proxy)
+	default:
+		return nil, errors.New("proxy: unsupported scheme: " + u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("proxy: missing host: " + proxy)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// connect opens a TCP connection to addr, through the proxy if any.
+func (c *Client) connect(ctx context.Context, addr string) (net.Conn, error) {
+	proxy, err := c.proxyURL(addr)
+	if err != nil {
+		return nil, err
+	}
+	return connect(ctx, addr, proxy)
+}
+
+func connect(ctx context.Context, addr string, proxy *url.URL) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if _, ok := ctx.Deadline(); !ok {
+		dialer.Timeout = defaultDialTimeout
+	}
+	if proxy == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	raw, err := dialer.DialContext(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	stop := watchContext(ctx, raw)
+	if _, ok := ctx.Deadline(); !ok {
+		raw.SetDeadline(time.Now().Add(defaultDialTimeout))
+	}
+
+	var conn net.Conn
+	switch proxy.Scheme {
+	case "http":
+		conn, err = httpConnect(raw, addr, proxy.User)
+	case "socks5":
+		conn, err = socks5Connect(ctx, raw, addr, proxy.User, false)
+	case "socks5h":
+		conn, err = socks5Connect(ctx, raw, addr, proxy.User, true)
+	}
+	stop()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = contextError(ctx.Err())
+		}
+		return nil, err
+	}
+	raw.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// httpConnect opens a tunnel to addr with the CONNECT method (RFC 7231 4.3.6).
+func httpConnect(conn net.Conn, addr string, user *url.Userinfo) (net.Conn, error) {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+		req.Header["Proxy-Authorization"] = req.Header["Authorization"]
+		delete(req.Header, "Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		conn.Close()
+		return nil, ErrProxyAuth
+	case resp.StatusCode/100 != 2:
+		conn.Close()
+		return nil, errors.New("proxy: CONNECT " + addr + " refused: " + resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes have already been read.
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// SOCKS5 replies (RFC 1928 6)
+var socks5Errors = []string{
+	"",
+	"general SOCKS server failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// socks5Connect opens a connection to addr with the CONNECT command (RFC 1928),
+// authenticating with the username and password of user (RFC 1929).
+// The host is resolved by the proxy if remote, and locally otherwise.
+func socks5Connect(ctx context.Context, conn net.Conn, addr string, user *url.Userinfo, remote bool) (net.Conn, error) {
+	c, err := socks5Handshake(ctx, conn, addr, user, remote)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func socks5Handshake(ctx context.Context, conn net.Conn, addr string, user *url.Userinfo, remote bool) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 0xffff {
+		return nil, errors.New("proxy: invalid port: " + portStr)
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		req = appendSocks5IP(req, ip)
+	} else if remote {
+		if len(host) > 255 {
+			return nil, errors.New("proxy: host name too long: " + host)
+		}
+		req = append(req, 3, byte(len(host)))
+		req = append(req, host...)
+	} else {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, errors.New("proxy: no address for " + host)
+		}
+		req = appendSocks5IP(req, ips[0].IP)
+	}
+	req = append(req, byte(port>>8), byte(port))
+
+	methods := []byte{5, 1, 0}
+	if user != nil {
+		methods = []byte{5, 2, 0, 2}
+	}
+	if _, err := conn.Write(methods); err != nil {
+		return nil, err
+	}
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return nil, err
+	}
+	if b[0] != 5 {
+		return nil, errors.New("proxy: not a SOCKS5 server")
+	}
+	switch b[1] {
+	case 0:
+	case 2:
+		if user == nil {
+			return nil, ErrProxyAuth
+		}
+		if err := socks5Auth(conn, user); err != nil {
+			return nil, err
+		}
+	default:
+		if user == nil {
+			return nil, ErrProxyAuth
+		}
+		return nil, errors.New("proxy: no acceptable authentication method")
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	b = make([]byte, 4)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return nil, err
+	}
+	if rep := int(b[1]); rep != 0 {
+		msg := "unknown error " + strconv.Itoa(rep)
+		if rep < len(socks5Errors) {
+			msg = socks5Errors[rep]
+		}
+		return nil, errors.New("proxy: CONNECT " + addr + " refused: " + msg)
+	}
+
+	// skip the bound address
+	var n int
+	switch b[3] {
+	case 1:
+		n = net.IPv4len
+	case 4:
+		n = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(conn, b[:1]); err != nil {
+			return nil, err
+		}
+		n = int(b[0])
+	default:
+		return nil, errors.New("proxy: invalid address type in reply")
+	}
+	if _, err := io.ReadFull(conn, make([]byte, n+2)); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func appendSocks5IP(b []byte, ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return append(append(b, 1), ip4...)
+	}
+	return append(append(b, 4), ip.To16()...)
+}
+
+// socks5Auth authenticates with a username and a password (RFC 1929).
+func socks5Auth(conn net.Conn, user *url.Userinfo) error {
+	password, _ := user.Password()
+	if len(user.Username()) > 255 || len(password) > 255 {
+		return errors.New("proxy: username or password too long")
+	}
+	b := []byte{1, byte(len(user.Username()))}
+	b = append(b, user.Username()...)
+	b = append(b, byte(len(password)))
+	b = append(b, password...)
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(conn, b[:2]); err != nil {
+		return err
+	}
+	if b[1] != 0 {
+		return ErrProxyAuth
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// proxy test
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProxyURL(t *testing.T) {
+	for _, env := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy",
+		"ALL_PROXY", "all_proxy", "NO_PROXY", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(env, "")
+	}
+	for _, tt := range []struct {
+		proxy, https, all, no, addr, want string
+	}{
+		{addr: "example.com:5222"},
+		{proxy: "proxy:3128", addr: "example.com:5222", want: "http://proxy:3128"},
+		{proxy: "socks5h://proxy", no: "example.com", addr: "example.com:5222", want: "socks5h://proxy:1080"},
+		{https: "http://proxy", addr: "example.com:5222", want: "http://proxy:80"},
+		{https: "proxy:3128", addr: "example.com:5222", want: "http://proxy:3128"},
+		{all: "socks5://proxy", addr: "example.com:5222", want: "socks5://proxy:1080"},
+		{https: "socks5h://proxy:9050", addr: "example.com:5222", want: "socks5h://proxy:9050"},
+		{https: "http://proxy", no: "example.com", addr: "example.com:5222"},
+		{https: "http://proxy", no: ".example.com", addr: "xmpp.example.com:5222"},
+		{all: "socks5://proxy", no: "*", addr: "example.com:5222"},
+		{https: "http://proxy", no: "example.org", addr: "example.com:5222", want: "http://proxy:80"},
+	} {
+		t.Setenv("HTTPS_PROXY", tt.https)
+		t.Setenv("ALL_PROXY", tt.all)
+		t.Setenv("NO_PROXY", tt.no)
+		c := NewClient("", "juliet@example.com", "secret", &Options{Proxy: tt.proxy})
+		u, err := c.proxyURL(tt.addr)
+		if err != nil {
+			t.Errorf("%+v: %v", tt, err)
+			continue
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != tt.want {
+			t.Errorf("%+v: got proxy %q, want %q", tt, got, tt.want)
+		}
+	}
+}
+
+func TestProxyHTTPS(t *testing.T) {
+	t.Setenv("ALL_PROXY", "")
+	t.Setenv("NO_PROXY", "")
+	for _, opts := range []*Options{{Proxy: "https://proxy:3128"}, {}} {
+		t.Setenv("HTTPS_PROXY", "https://proxy:3128")
+		c := NewClient("", "juliet@example.com", "secret", opts)
+		if _, err := c.proxyURL("example.com:5222"); err == nil || !strings.Contains(err.Error(), "TLS") {
+			t.Errorf("Proxy %q: got error %v, want TLS to the proxy rejected", opts.Proxy, err)
+		}
+	}
+}
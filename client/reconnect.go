@@ -0,0 +1,174 @@
+// reconnect
+package client
+
+import (
+	"fmt"
+	xmpp "github.com/ginuerzh/goxmpp"
+	"github.com/ginuerzh/goxmpp/core"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff is the reconnection policy of Run: the delay before each attempt grows
+// exponentially from Min to Max, randomized by Jitter so that many clients
+// disconnected together do not reconnect all at once.
+// Zero fields take the value of DefaultBackoff.
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+	// Jitter is the fraction of the delay it is randomized by, between 0 and 1,
+	// NoJitter not to randomize it.
+	Jitter float64
+	// MaxAttempts is the number of failed attempts after which Run gives up,
+	// 0 to retry forever.
+	MaxAttempts int
+}
+
+// NoJitter, as Backoff.Jitter, disables the randomization of the delays,
+// a zero Jitter taking the one of DefaultBackoff.
+const NoJitter = -1
+
+var DefaultBackoff = Backoff{
+	Min:    time.Second,
+	Max:    2 * time.Minute,
+	Factor: 2,
+	Jitter: 0.2,
+}
+
+// Delay returns the delay before the attempt, counted from 1.
+func (b *Backoff) Delay(attempt int) time.Duration {
+	min, max, factor, jitter := b.Min, b.Max, b.Factor, b.Jitter
+	if min <= 0 {
+		min = DefaultBackoff.Min
+	}
+	if max <= 0 {
+		max = DefaultBackoff.Max
+	}
+	if factor < 1 {
+		factor = DefaultBackoff.Factor
+	}
+	switch {
+	case jitter == 0:
+		jitter = DefaultBackoff.Jitter
+	case jitter < 0:
+		jitter = 0
+	case jitter > 1:
+		jitter = 1
+	}
+
+	d := math.Min(float64(min)*math.Pow(factor, float64(attempt-1)), float64(max))
+	d += d * jitter * (2*rand.Float64() - 1)
+	return time.Duration(d)
+}
+
+type DisconnectFunc func(err error)
+type ReconnectFunc func(attempt int, delay time.Duration)
+type ResumeFunc func()
+
+// OnDisconnected sets the function called when the connection is lost.
+func (c *Client) OnDisconnected(f DisconnectFunc) {
+	c.disconnectHandler = f
+}
+
+// OnReconnecting sets the function called before waiting to reconnect.
+func (c *Client) OnReconnecting(f ReconnectFunc) {
+	c.reconnectHandler = f
+}
+
+// OnResumed sets the function called instead of the login one when the stream
+// management session is resumed: the presence and the pending stanzas are kept
+// by the server, so there is nothing to restore.
+func (c *Client) OnResumed(f ResumeFunc) {
+	c.resumeHandler = f
+}
+
+// reconnect logs in again, waiting before each attempt as specified by the
+// backoff policy. It returns the error of the last attempt if it gives up.
+func (c *Client) reconnect(err error) error {
+	b := c.Opts.Reconnect
+	for attempt := 1; b.MaxAttempts == 0 || attempt <= b.MaxAttempts; attempt++ {
+		if !temporary(err) {
+			return err
+		}
+
+		delay := b.Delay(attempt)
+		if c.reconnectHandler != nil {
+			go c.reconnectHandler(attempt, delay)
+		}
+		if c.Opts.Debug {
+			fmt.Println("reconnect in", delay, "after:", err)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-c.quit:
+			return err
+		}
+
+		if err = c.login(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// login logs in, restores the presence of the previous session if it was not
+// resumed, and fires the login callbacks.
+func (c *Client) login() error {
+	err := c.Login()
+	if err == nil && c.smResumed {
+		if c.resumeHandler != nil {
+			go c.resumeHandler()
+		}
+		return nil
+	}
+	if err == nil && c.presence != nil && !c.presenceResent {
+		err = c.write(c.presence)
+	}
+	if c.loginHandler != nil {
+		go c.loginHandler(err)
+	}
+	return err
+}
+
+// trackPresence keeps the last broadcast presence sent, to be restored on reconnection.
+func (c *Client) trackPresence(e xmpp.Element) {
+	st, ok := e.(*xmpp.Stanza)
+	if !ok || st.Name() != "presence" || st.To != "" {
+		return
+	}
+	switch st.Types {
+	case "":
+		c.presence = st
+	case "unavailable":
+		c.presence = nil
+	}
+}
+
+// closed reports whether Close was called since Run started. It is called by Run,
+// or with runLock held.
+func (c *Client) closed() bool {
+	select {
+	case <-c.quit:
+		return true
+	default:
+	}
+	return false
+}
+
+// temporary tells whether logging in again may succeed after the error.
+// Authentication and configuration errors are permanent.
+func temporary(err error) bool {
+	switch v := err.(type) {
+	case *core.SaslFailure, *core.Sasl2Failure, *core.TlsFailure, *OAuthError:
+		return false
+	case *core.StreamError:
+		switch v.Condition() {
+		case core.StreamConflict, core.StreamNotAuthorized, core.StreamHostUnknown, core.StreamPolicyViolation:
+			return false
+		}
+	}
+	return err != ErrStartTLSNotOffered && err != ErrNotEncrypted && err != ErrProxyAuth && err != ErrCompressionSASL2
+}
@@ -0,0 +1,173 @@
+// reconnect test
+package client
+
+import (
+	"context"
+	xmpp "github.com/ginuerzh/goxmpp"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := &Backoff{Min: time.Second, Max: 10 * time.Second, Jitter: NoJitter}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		if got := b.Delay(attempt + 1); got != want {
+			t.Errorf("attempt %d: got %v, want %v", attempt+1, got, want)
+		}
+	}
+
+	// the zero Jitter is the one of DefaultBackoff.
+	b.Jitter = 0
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(1); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("got %v, want 1s ± 20%%", d)
+		}
+	}
+}
+
+// TestReconnect drops the connection once the presence is sent: the client
+// reconnects, fails to resume the session, and sends the presence again, once.
+func TestReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- func() error {
+			conn, err := ln.Accept()
+			if err != nil {
+				return err
+			}
+			s := &fakeServer{conn: conn}
+			if err := s.auth("<sm xmlns='urn:xmpp:sm:3'/>"); err != nil {
+				return err
+			}
+			if err := s.bind("juliet@example.com/balcony"); err != nil {
+				return err
+			}
+			if _, err := s.expect("enable"); err != nil {
+				return err
+			}
+			if err := s.write("<enabled xmlns='urn:xmpp:sm:3' id='sm1' resume='true'/>"); err != nil {
+				return err
+			}
+			if _, err := s.expect("presence"); err != nil {
+				return err
+			}
+			conn.Close()
+
+			if conn, err = ln.Accept(); err != nil {
+				return err
+			}
+			defer func() { go io.Copy(io.Discard, conn) }()
+			s = &fakeServer{conn: conn}
+			if err := s.auth("<sm xmlns='urn:xmpp:sm:3'/>"); err != nil {
+				return err
+			}
+			if _, err := s.expect("resume"); err != nil {
+				return err
+			}
+			if err := s.write("<failed xmlns='urn:xmpp:sm:3'><item-not-found xmlns='urn:ietf:params:xml:ns:xmpp-stanzas'/></failed>"); err != nil {
+				return err
+			}
+			if err := s.bind("juliet@example.com/balcony"); err != nil {
+				return err
+			}
+			if _, err := s.expect("enable"); err != nil {
+				return err
+			}
+			if err := s.write("<enabled xmlns='urn:xmpp:sm:3' id='sm2' resume='true'/>"); err != nil {
+				return err
+			}
+			if _, err := s.expect("presence"); err != nil {
+				return err
+			}
+			_, err = s.expect("message")
+			return err
+		}()
+	}()
+
+	c := NewClient(ln.Addr().String(), "juliet@example.com", "secret", &Options{
+		Security:         SecurityNone,
+		StreamManagement: true,
+		Reconnect:        &Backoff{Min: 10 * time.Millisecond, Max: 10 * time.Millisecond, Jitter: NoJitter},
+	})
+	logins := make(chan error, 2)
+	c.OnLogined(func(err error) { logins <- err })
+	disconnects := make(chan error, 1)
+	c.OnDisconnected(func(err error) { disconnects <- err })
+	delays := make(chan time.Duration, 1)
+	c.OnReconnecting(func(attempt int, delay time.Duration) { delays <- delay })
+
+	run := make(chan error, 1)
+	go func() { run <- c.Run() }()
+
+	if err := <-logins; err != nil {
+		t.Fatal("login:", err)
+	}
+	c.Send(xmpp.NewPresence("", "", ""))
+	<-disconnects
+	if d := <-delays; d != 10*time.Millisecond {
+		t.Errorf("reconnecting in %v, want 10ms", d)
+	}
+	if err := <-logins; err != nil {
+		t.Fatal("login again:", err)
+	}
+	c.Send(xmpp.NewMessage("chat", "romeo@example.com", "back", ""))
+
+	if err := <-done; err != nil {
+		t.Fatal("server:", err)
+	}
+	c.Close()
+	if err := <-run; err != nil {
+		t.Errorf("Run returned %v after Close", err)
+	}
+}
+
+// TestCloseReconnecting closes the client while it connects again: the new
+// connection is closed, and Run returns.
+func TestCloseReconnecting(t *testing.T) {
+	c := newFakeClient(t, &Options{
+		Reconnect: &Backoff{Min: time.Millisecond, Max: time.Millisecond, Jitter: NoJitter},
+	}, func(s *fakeServer) error {
+		if err := s.login("juliet@example.com/balcony"); err != nil {
+			return err
+		}
+		return s.conn.Close()
+	})
+	conn, srv := net.Pipe()
+	dialing := make(chan struct{})
+	closed := make(chan struct{})
+	dial, dials := c.Opts.Dial, 0
+	c.Opts.Dial = func(ctx context.Context, domain string) (Transport, error) {
+		if dials++; dials == 1 {
+			return dial(ctx, domain)
+		}
+		close(dialing)
+		<-closed
+		return NewStreamTransport(conn), nil
+	}
+	c.start()
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, srv)
+		read <- err
+	}()
+
+	<-dialing
+	c.Close()
+	close(closed)
+	if err := <-c.run; err != nil {
+		t.Errorf("Run returned %v after Close", err)
+	}
+	if err := <-read; err != nil {
+		t.Errorf("reading the new connection: %v", err)
+	}
+	c.wait()
+}
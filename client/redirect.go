@@ -0,0 +1,44 @@
+// redirect
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/ginuerzh/goxmpp/core"
+)
+
+// maxRedirects limits the see-other-host redirects followed by a login.
+const maxRedirects = 5
+
+var ErrTooManyRedirects = errors.New("xmpp: too many see-other-host redirects")
+
+// RedirectFunc is called with the host, or the WebSocket URI, the server redirects to.
+type RedirectFunc func(target string)
+
+// OnRedirect sets the function called when the server redirects the client to
+// another host during login (RFC 6120 4.9.3.19).
+func (c *Client) OnRedirect(f RedirectFunc) {
+	c.redirectHandler = f
+}
+
+// seeOther returns the host or the URI that err redirects to, "" if none.
+func seeOther(err error) string {
+	switch v := err.(type) {
+	case *core.StreamError:
+		if v.Condition() == core.StreamSeeOtherHost {
+			return v.SeeOtherHost
+		}
+	case *core.FramingClose:
+		return v.SeeOtherUri
+	}
+	return ""
+}
+
+// dialRedirect connects to the target of a redirect. The domain stays the same,
+// the certificate of the new host is verified against it.
+func (c *Client) dialRedirect(ctx context.Context, target, domain string) error {
+	if c.Opts.WebSocket {
+		return c.dialWebSocketURL(ctx, target)
+	}
+	return c.dial(ctx, hostEndpoint(target, c.security()), domain)
+}
@@ -0,0 +1,555 @@
+// sasl
+package client
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	xmpp "github.com/ginuerzh/goxmpp"
+	"github.com/ginuerzh/goxmpp/core"
+	"math/big"
+	"strings"
+)
+
+// Mechanism is a SASL authentication mechanism (RFC 4422).
+type Mechanism interface {
+	// Name returns the name of the mechanism as advertised by the server, like "SCRAM-SHA-1".
+	Name() string
+
+	// Start begins the authentication and returns the initial response.
+	// A nil response means that there is no initial response.
+	// It returns ErrMechanismUnavailable if the mechanism cannot be used with info,
+	// in which case the next one of the preference list is tried.
+	Start(info *SaslInfo) ([]byte, error)
+
+	// Next returns the response to a challenge of the server.
+	// If more is false, data is the additional data sent with <success/>,
+	// which the mechanism must verify; the response is then ignored.
+	Next(data []byte, more bool) ([]byte, error)
+}
+
+// SaslInfo holds what a mechanism needs to authenticate.
+type SaslInfo struct {
+	// Domain is the domainpart of the JID.
+	Domain string
+	// User is the localpart of the JID, used as authentication identity.
+	// It is empty for anonymous login.
+	User     string
+	Password string
+	// Token is the OAuth 2.0 access token from Client.TokenSource.
+	Token string
+	// FastToken is the FAST token to authenticate with the HT-* mechanisms.
+	FastToken string
+	// Authzid is the authorization identity, if different from the one derived from User.
+	Authzid string
+	// ClientCert tells whether a client certificate is presented in the TLS handshake.
+	ClientCert bool
+
+	// Mechanisms are the mechanisms offered by the server.
+	Mechanisms []string
+	// TLS is the state of the TLS connection, nil if not encrypted.
+	TLS *tls.ConnectionState
+	// Insecure allows the mechanisms sending the password in clear text without TLS,
+	// the connection being unencrypted by choice (SecurityNone).
+	Insecure bool
+	// ChannelBindings are the channel binding types supported by the server (XEP-0440),
+	// nil if it does not tell.
+	ChannelBindings []string
+}
+
+var (
+	ErrMechanismUnavailable = errors.New("sasl: mechanism unavailable")
+)
+
+// failer is implemented by mechanisms that learn the cause of an authentication
+// failure during the exchange, which is more useful than the <failure/> that follows.
+type failer interface {
+	failure() error
+}
+
+type MechanismFunc func() Mechanism
+
+var mechanisms = make(map[string]MechanismFunc)
+
+// RegisterMechanism makes a mechanism available for authentication by name.
+// It replaces any mechanism registered with the same name.
+func RegisterMechanism(name string, newFunc MechanismFunc) {
+	mechanisms[name] = newFunc
+}
+
+// DefaultMechanisms is the preference list used when Options.Mechanisms is empty,
+// strongest first.
+var DefaultMechanisms = []string{
+	"EXTERNAL",
+	"OAUTHBEARER",
+	"X-OAUTH2",
+	"SCRAM-SHA-512-PLUS",
+	"SCRAM-SHA-256-PLUS",
+	"SCRAM-SHA-1-PLUS",
+	"SCRAM-SHA-512",
+	"SCRAM-SHA-256",
+	"SCRAM-SHA-1",
+	"PLAIN",
+	"DIGEST-MD5",
+	"ANONYMOUS",
+}
+
+func init() {
+	RegisterMechanism("EXTERNAL", func() Mechanism { return new(externalAuth) })
+	RegisterMechanism("ANONYMOUS", func() Mechanism { return new(anonymousAuth) })
+	RegisterMechanism("OAUTHBEARER", func() Mechanism { return new(oauthBearerAuth) })
+	RegisterMechanism("X-OAUTH2", func() Mechanism { return new(xOAuth2Auth) })
+	RegisterMechanism("PLAIN", func() Mechanism { return new(plainAuth) })
+	RegisterMechanism("DIGEST-MD5", func() Mechanism { return new(digestMD5Auth) })
+	RegisterMechanism("SCRAM-SHA-1", func() Mechanism { return newScramAuth("SCRAM-SHA-1", sha1.New, false) })
+	RegisterMechanism("SCRAM-SHA-256", func() Mechanism { return newScramAuth("SCRAM-SHA-256", sha256.New, false) })
+	RegisterMechanism("SCRAM-SHA-512", func() Mechanism { return newScramAuth("SCRAM-SHA-512", sha512.New, false) })
+	RegisterMechanism("SCRAM-SHA-1-PLUS", func() Mechanism { return newScramAuth("SCRAM-SHA-1-PLUS", sha1.New, true) })
+	RegisterMechanism("SCRAM-SHA-256-PLUS", func() Mechanism { return newScramAuth("SCRAM-SHA-256-PLUS", sha256.New, true) })
+	RegisterMechanism("SCRAM-SHA-512-PLUS", func() Mechanism { return newScramAuth("SCRAM-SHA-512-PLUS", sha512.New, true) })
+}
+
+// startMechanism starts the first mechanism of the preference list that is
+// offered by the server and available, and returns it with its initial response.
+func startMechanism(preferred []string, info *SaslInfo) (Mechanism, []byte, error) {
+	if len(preferred) == 0 {
+		preferred = DefaultMechanisms
+	}
+	for _, name := range preferred {
+		newFunc, ok := mechanisms[name]
+		if !ok || !info.offers(name) {
+			continue
+		}
+		m := newFunc()
+		ir, err := m.Start(info)
+		if err == ErrMechanismUnavailable {
+			continue
+		}
+		return m, ir, err
+	}
+	return nil, nil, errors.New(
+		fmt.Sprintf("xmpp: no supported SASL mechanism in %v", info.Mechanisms))
+}
+
+func (info *SaslInfo) offers(name string) bool {
+	return contains(info.Mechanisms, name)
+}
+
+// secure reports whether the password may be sent by PLAIN or DIGEST-MD5: over TLS,
+// or on a connection unencrypted by choice.
+func (info *SaslInfo) secure() bool {
+	return info.TLS != nil || info.Insecure
+}
+
+func (c *Client) saslInfo(features *core.StreamFeatures, domain, user string) *SaslInfo {
+	info := &SaslInfo{
+		Domain:   domain,
+		User:     user,
+		Password: c.Password,
+		Token:    c.token,
+		Authzid:  c.Opts.Authzid,
+		TLS:      c.transport.ConnectionState(),
+		Insecure: c.security() == SecurityNone,
+	}
+	if config := c.Opts.TlsConfig; config != nil {
+		info.ClientCert = len(config.Certificates) > 0 || config.GetClientCertificate != nil
+	}
+	if features.Mechanisms != nil {
+		info.Mechanisms = features.Mechanisms.Mechanism
+	}
+	if features.ChannelBinding != nil {
+		info.ChannelBindings = []string{}
+		for _, cb := range features.ChannelBinding.Types {
+			info.ChannelBindings = append(info.ChannelBindings, cb.Type)
+		}
+	}
+	return info
+}
+
+// authenticate runs the SASL negotiation (RFC 6120 6.4) with the mechanism
+// chosen from the ones offered by the server.
+func (c *Client) authenticate(info *SaslInfo) error {
+	if len(info.Mechanisms) == 0 {
+		return errors.New("xmpp: server offers no SASL mechanism")
+	}
+	m, ir, err := startMechanism(c.Opts.Mechanisms, info)
+	if err != nil {
+		return err
+	}
+
+	e, err := c.request(&core.SaslAuth{Mechanism: m.Name(), Value: saslEncode(ir)})
+	for {
+		if err != nil {
+			if f, ok := m.(failer); ok && f.failure() != nil {
+				return f.failure()
+			}
+			return err
+		}
+
+		switch v := e.(type) {
+		case *core.SaslChallenge:
+			data, err := saslDecode(v.Value)
+			if err != nil {
+				return err
+			}
+			resp, err := m.Next(data, true)
+			if err != nil {
+				c.send(&core.SaslAbort{})
+				return err
+			}
+			e, err = c.request(&core.SaslResponse{Value: saslEncode(resp)})
+		case *core.SaslSuccess:
+			data, err := saslDecode(v.Value)
+			if err != nil {
+				return err
+			}
+			_, err = m.Next(data, false)
+			return err
+		default:
+			return errors.New("sasl: unexpected <" + e.Name() + ">")
+		}
+	}
+}
+
+// login2 authenticates with SASL2 (XEP-0388), binding a resource inline with
+// Bind 2 (XEP-0386) when offered. The stream is not restarted afterwards.
+// A FAST token (XEP-0484) is used if one is stored, falling back to the other
+// mechanisms if it is rejected, in which case a new token is requested.
+func (c *Client) login2(auth *core.Sasl2Authentication, info *SaslInfo) error {
+	inline := auth.Inline
+	if inline == nil {
+		inline = &core.Sasl2Inline{}
+	}
+	newRequest := func() *core.Sasl2Authenticate {
+		req := &core.Sasl2Authenticate{}
+		if inline.Bind != nil {
+			req.Bind = &core.Bind2{Tag: c.Opts.Resource}
+			if c.Opts.StreamManagement && inline.Sm != nil {
+				req.Bind.Enable = &core.SmEnable{Resume: true}
+			}
+		}
+		if c.resumable() && inline.Sm != nil {
+			req.Resume = &core.SmResume{H: c.sm.handled(), Previd: c.sm.id}
+		}
+		return req
+	}
+
+	var success *core.Sasl2Success
+	var err error
+	fast := c.fastFeature(auth)
+	if fast != nil {
+		if success, err = c.fastAuthenticate(fast, info, newRequest()); err != nil {
+			return err
+		}
+	}
+
+	if success == nil {
+		info.Mechanisms = auth.Mechanism
+		req := newRequest()
+		req.RequestToken = requestToken(fast, info)
+		if success, err = c.authenticate2(c.Opts.Mechanisms, info, req); err != nil {
+			return err
+		}
+		if req.RequestToken != nil && success.Token != nil {
+			if err := c.storeToken(info, req.RequestToken.Mechanism, success.Token); err != nil {
+				return err
+			}
+		}
+	}
+
+	if success.Resumed != nil {
+		return c.resumed(success.Resumed)
+	}
+	if success.Failed != nil {
+		c.resumeFailed(success.Failed.H)
+	}
+	c.resumeFailed(nil)
+
+	if success.Bound == nil {
+		features, err := c.bind()
+		if err != nil {
+			return err
+		}
+		// without Bind 2, stream management is enabled after binding, like after SASL.
+		if c.Opts.StreamManagement && (inline.Sm != nil || (features != nil && features.Sm != nil)) {
+			if err := c.enableSM(); err != nil {
+				return err
+			}
+		}
+	} else {
+		c.Jid = xmpp.ToJID(success.AuthorizationIdentifier)
+		if success.Bound.Enabled != nil {
+			c.setSM(newStreamManagement(success.Bound.Enabled))
+		}
+	}
+	return c.resendUnacked()
+}
+
+// authenticate2 runs the SASL2 negotiation with the first mechanism of the preference
+// list that is available. req holds the elements to send along with the authentication.
+func (c *Client) authenticate2(preferred []string, info *SaslInfo, req *core.Sasl2Authenticate) (*core.Sasl2Success, error) {
+	m, ir, err := startMechanism(preferred, info)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Mechanism = m.Name()
+	req.InitialResponse = saslEncode(ir)
+	req.UserAgent = c.Opts.UserAgent
+	e, err := c.request(req)
+	for {
+		if err != nil {
+			if f, ok := m.(failer); ok && f.failure() != nil {
+				return nil, f.failure()
+			}
+			return nil, err
+		}
+
+		switch v := e.(type) {
+		case *core.Sasl2Challenge:
+			data, err := saslDecode(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := m.Next(data, true)
+			if err != nil {
+				c.send(&core.Sasl2Abort{})
+				return nil, err
+			}
+			e, err = c.request(&core.Sasl2Response{Value: saslEncode(resp)})
+		case *core.Sasl2Success:
+			data, err := saslDecode(v.AdditionalData)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = m.Next(data, false); err != nil {
+				return nil, err
+			}
+			return v, nil
+		case *core.Sasl2Continue:
+			c.send(&core.Sasl2Abort{})
+			return nil, errors.New(
+				fmt.Sprintf("sasl2: unsupported tasks %v", v.Tasks))
+		default:
+			return nil, errors.New("sasl2: unexpected <" + e.Name() + ">")
+		}
+	}
+}
+
+// saslEncode encodes a response, "=" standing for an empty one (RFC 6120 6.4.2).
+func saslEncode(b []byte) string {
+	if b == nil {
+		return ""
+	}
+	if len(b) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func saslDecode(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "=" {
+		return []byte{}, nil
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// EXTERNAL (RFC 4422 Appendix A), with the client certificate of the TLS connection (XEP-0178).
+type externalAuth struct{}
+
+func (_ externalAuth) Name() string {
+	return "EXTERNAL"
+}
+
+func (_ externalAuth) Start(info *SaslInfo) ([]byte, error) {
+	if info.TLS == nil || !info.ClientCert {
+		return nil, ErrMechanismUnavailable
+	}
+	return []byte(info.Authzid), nil
+}
+
+func (_ externalAuth) Next(data []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("sasl: unexpected challenge for EXTERNAL")
+	}
+	return nil, nil
+}
+
+// ANONYMOUS (RFC 4505), used when there is no localpart to authenticate with.
+type anonymousAuth struct{}
+
+func (_ anonymousAuth) Name() string {
+	return "ANONYMOUS"
+}
+
+func (_ anonymousAuth) Start(info *SaslInfo) ([]byte, error) {
+	if info.User != "" {
+		return nil, ErrMechanismUnavailable
+	}
+	return []byte{}, nil
+}
+
+func (_ anonymousAuth) Next(data []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("sasl: unexpected challenge for ANONYMOUS")
+	}
+	return nil, nil
+}
+
+// PLAIN (RFC 4616)
+type plainAuth struct{}
+
+func (_ plainAuth) Name() string {
+	return "PLAIN"
+}
+
+func (_ plainAuth) Start(info *SaslInfo) ([]byte, error) {
+	if info.User == "" || info.Password == "" || !info.secure() {
+		return nil, ErrMechanismUnavailable
+	}
+	return []byte(info.Authzid + "\x00" + info.User + "\x00" + info.Password), nil
+}
+
+func (_ plainAuth) Next(data []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("sasl: unexpected challenge for PLAIN")
+	}
+	return nil, nil
+}
+
+// DIGEST-MD5 (RFC 2831), deprecated by RFC 6331.
+type digestMD5Auth struct {
+	info    *SaslInfo
+	rspauth string
+	step    int
+}
+
+func (_ digestMD5Auth) Name() string {
+	return "DIGEST-MD5"
+}
+
+func (a *digestMD5Auth) Start(info *SaslInfo) ([]byte, error) {
+	if info.User == "" || info.Password == "" || !info.secure() {
+		return nil, ErrMechanismUnavailable
+	}
+	a.info = info
+	return nil, nil
+}
+
+func (a *digestMD5Auth) Next(data []byte, more bool) ([]byte, error) {
+	switch a.step {
+	case 0:
+		if !more {
+			return nil, errors.New("sasl: DIGEST-MD5 succeeded without challenge")
+		}
+		a.step++
+		return a.response(data)
+	case 1:
+		tokens := digestTokens(data)
+		if len(data) == 0 && !more {
+			return nil, errors.New("sasl: DIGEST-MD5 server did not send rspauth")
+		}
+		if tokens["rspauth"] != a.rspauth {
+			return nil, errors.New("sasl: DIGEST-MD5 rspauth mismatch")
+		}
+		a.step++
+		return []byte{}, nil
+	}
+
+	if more {
+		return nil, errors.New("sasl: unexpected challenge for DIGEST-MD5")
+	}
+	return nil, nil
+}
+
+func (a *digestMD5Auth) response(challenge []byte) ([]byte, error) {
+	tokens := digestTokens(challenge)
+	realm := tokens["realm"]
+	nonce := tokens["nonce"]
+	if nonce == "" {
+		return nil, errors.New("sasl: DIGEST-MD5 challenge without nonce")
+	}
+	charset := tokens["charset"]
+	cnonceStr := cnonce()
+	digestUri := "xmpp/" + a.info.Domain
+	nonceCount := fmt.Sprintf("%08x", 1)
+	digest := saslDigestResponse(a.info.User, realm, a.info.Password,
+		nonce, cnonceStr, "AUTHENTICATE", digestUri, nonceCount, a.info.Authzid)
+	a.rspauth = saslDigestResponse(a.info.User, realm, a.info.Password,
+		nonce, cnonceStr, "", digestUri, nonceCount, a.info.Authzid)
+	message := "username=\"" + a.info.User + "\"" +
+		",realm=\"" + realm + "\"" +
+		",nonce=\"" + nonce + "\"" +
+		",cnonce=\"" + cnonceStr + "\"" +
+		",nc=" + nonceCount +
+		",qop=auth" +
+		",digest-uri=\"" + digestUri + "\"" +
+		",response=" + digest
+	if a.info.Authzid != "" {
+		message += ",authzid=\"" + a.info.Authzid + "\""
+	}
+	if charset != "" {
+		message += ",charset=" + charset
+	}
+
+	return []byte(message), nil
+}
+
+func digestTokens(b []byte) map[string]string {
+	tokens := map[string]string{}
+	for _, token := range strings.Split(string(b), ",") {
+		kv := strings.SplitN(strings.TrimSpace(token), "=", 2)
+		if len(kv) == 2 {
+			if len(kv[1]) > 1 && kv[1][0] == '"' && kv[1][len(kv[1])-1] == '"' {
+				kv[1] = kv[1][1 : len(kv[1])-1]
+			}
+			tokens[kv[0]] = kv[1]
+		}
+	}
+	return tokens
+}
+
+func cnonce() string {
+	randSize := big.NewInt(0)
+	randSize.Lsh(big.NewInt(1), 64)
+	cn, err := rand.Int(rand.Reader, randSize)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%016x", cn)
+}
+
+// saslDigestResponse returns the response of DIGEST-MD5 (RFC 2831 2.1.2.1),
+// or the rspauth of the server if authenticate is empty.
+func saslDigestResponse(username, realm, passwd, nonce, cnonceStr,
+	authenticate, digestUri, nonceCountStr, authzid string) string {
+	h := func(text string) []byte {
+		h := md5.New()
+		h.Write([]byte(text))
+		return h.Sum(nil)
+	}
+	hex := func(bytes []byte) string {
+		return fmt.Sprintf("%x", bytes)
+	}
+	kd := func(secret, data string) []byte {
+		return h(secret + ":" + data)
+	}
+
+	a1 := string(h(username+":"+realm+":"+passwd)) + ":" +
+		nonce + ":" + cnonceStr
+	if authzid != "" {
+		a1 += ":" + authzid
+	}
+	a2 := authenticate + ":" + digestUri
+	response := hex(kd(hex(h(a1)), nonce+":"+
+		nonceCountStr+":"+cnonceStr+":auth:"+
+		hex(h(a2))))
+	return response
+}
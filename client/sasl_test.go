@@ -0,0 +1,25 @@
+// sasl test
+package client
+
+import (
+	"testing"
+)
+
+func TestDigestMD5Response(t *testing.T) {
+	for _, tt := range []struct {
+		authzid, response, rspauth string
+	}{
+		// the example of RFC 2831 4
+		{"", "d388dad90d4bbd760a152321f2143af7", "ea40f60335c427b5527b84dbabcdfffd"},
+		{"admin", "23e90c577367d8f917efa6ba0cb7eebc", "9a3915030cc8922097cd627a25ee2b9e"},
+	} {
+		if got := saslDigestResponse("chris", "elwood.innosoft.com", "secret", "OA6MG9tEQGm2hh",
+			"OA6MHXh6VqTrRk", "AUTHENTICATE", "imap/elwood.innosoft.com", "00000001", tt.authzid); got != tt.response {
+			t.Errorf("authzid %q: got response %s, want %s", tt.authzid, got, tt.response)
+		}
+		if got := saslDigestResponse("chris", "elwood.innosoft.com", "secret", "OA6MG9tEQGm2hh",
+			"OA6MHXh6VqTrRk", "", "imap/elwood.innosoft.com", "00000001", tt.authzid); got != tt.rspauth {
+			t.Errorf("authzid %q: got rspauth %s, want %s", tt.authzid, got, tt.rspauth)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// scram
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/text/secure/precis"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// SCRAM (RFC 5802, RFC 7677), with channel binding for the -PLUS variants.
+type scramAuth struct {
+	name string
+	h    func() hash.Hash
+	plus bool
+
+	info            *SaslInfo
+	gs2Header       string
+	cbData          []byte
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+	step            int
+}
+
+func newScramAuth(name string, h func() hash.Hash, plus bool) *scramAuth {
+	return &scramAuth{name: name, h: h, plus: plus}
+}
+
+func (a *scramAuth) Name() string {
+	return a.name
+}
+
+func (a *scramAuth) Start(info *SaslInfo) ([]byte, error) {
+	if info.User == "" || info.Password == "" {
+		return nil, ErrMechanismUnavailable
+	}
+	a.info = info
+
+	cbType, cbData := channelBinding(info.TLS, info.ChannelBindings)
+	switch {
+	case a.plus:
+		if cbType == "" {
+			return nil, ErrMechanismUnavailable
+		}
+		a.gs2Header = "p=" + cbType
+		a.cbData = cbData
+	case cbType != "" && !info.offersPlus():
+		// we support channel binding but the server does not seem to.
+		a.gs2Header = "y"
+	default:
+		a.gs2Header = "n"
+	}
+	if info.Authzid != "" {
+		a.gs2Header += ",a=" + scramName(info.Authzid) + ","
+	} else {
+		a.gs2Header += ",,"
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	a.clientNonce = base64.RawStdEncoding.EncodeToString(b)
+
+	a.clientFirstBare = "n=" + scramName(info.User) + ",r=" + a.clientNonce
+
+	return []byte(a.gs2Header + a.clientFirstBare), nil
+}
+
+func (a *scramAuth) Next(data []byte, more bool) ([]byte, error) {
+	switch a.step {
+	case 0:
+		if !more {
+			return nil, errors.New("sasl: " + a.name + " succeeded without challenge")
+		}
+		a.step++
+		return a.clientFinal(string(data))
+	case 1:
+		if len(data) == 0 && !more {
+			return nil, errors.New("sasl: " + a.name + " server did not send its signature")
+		}
+		if err := a.verify(string(data)); err != nil {
+			return nil, err
+		}
+		a.step++
+		return []byte{}, nil
+	}
+
+	if more {
+		return nil, errors.New("sasl: unexpected challenge for " + a.name)
+	}
+	return nil, nil
+}
+
+func (a *scramAuth) clientFinal(serverFirst string) ([]byte, error) {
+	attrs := scramAttrs(serverFirst)
+	if _, ok := attrs["m"]; ok {
+		return nil, errors.New("sasl: unsupported SCRAM extension")
+	}
+
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, a.clientNonce) || len(nonce) == len(a.clientNonce) {
+		return nil, errors.New("sasl: invalid SCRAM server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("sasl: invalid SCRAM salt")
+	}
+	iter, err := strconv.Atoi(attrs["i"])
+	if err != nil || iter <= 0 {
+		return nil, errors.New("sasl: invalid SCRAM iteration count")
+	}
+
+	cbind := append([]byte(a.gs2Header), a.cbData...)
+	clientFinalBare := "c=" + base64.StdEncoding.EncodeToString(cbind) + ",r=" + nonce
+	authMessage := []byte(a.clientFirstBare + "," + serverFirst + "," + clientFinalBare)
+
+	// the password is prepared as an OpaqueString (RFC 7613 4.2), which supersedes SASLprep.
+	password, err := precis.OpaqueString.String(a.info.Password)
+	if err != nil {
+		return nil, errors.New("sasl: invalid password: " + err.Error())
+	}
+	saltedPassword := pbkdf2(a.h, []byte(password), salt, iter)
+	clientKey := a.hmac(saltedPassword, []byte("Client Key"))
+	storedKey := a.hash(clientKey)
+	clientSignature := a.hmac(storedKey, authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	serverKey := a.hmac(saltedPassword, []byte("Server Key"))
+	a.serverSignature = a.hmac(serverKey, authMessage)
+
+	return []byte(clientFinalBare + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+func (a *scramAuth) verify(serverFinal string) error {
+	attrs := scramAttrs(serverFinal)
+	if e, ok := attrs["e"]; ok {
+		return errors.New("sasl: " + a.name + " server error: " + e)
+	}
+	v, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(v, a.serverSignature) {
+		return errors.New("sasl: " + a.name + " server signature mismatch")
+	}
+	return nil
+}
+
+func (a *scramAuth) hmac(key, data []byte) []byte {
+	mac := hmac.New(a.h, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (a *scramAuth) hash(data []byte) []byte {
+	h := a.h()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// channelBinding returns the channel binding type to use with the TLS connection,
+// among the ones supported by the server if known, and its data.
+// tls-exporter (RFC 9266) is used with TLS 1.3 and tls-unique (RFC 5929) with earlier versions.
+func channelBinding(state *tls.ConnectionState, supported []string) (string, []byte) {
+	if state == nil {
+		return "", nil
+	}
+
+	types := []string{"tls-unique", "tls-exporter"}
+	if state.Version >= tls.VersionTLS13 {
+		types = []string{"tls-exporter"}
+	}
+	for _, typ := range types {
+		if supported != nil && !contains(supported, typ) {
+			continue
+		}
+		switch typ {
+		case "tls-exporter":
+			data, err := state.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+			if err == nil {
+				return typ, data
+			}
+		case "tls-unique":
+			if len(state.TLSUnique) > 0 {
+				return typ, state.TLSUnique
+			}
+		}
+	}
+	return "", nil
+}
+
+func (info *SaslInfo) offersPlus() bool {
+	for _, m := range info.Mechanisms {
+		if strings.HasSuffix(m, "-PLUS") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// scramName escapes a username as a saslname.
+func scramName(s string) string {
+	s = strings.Replace(s, "=", "=3D", -1)
+	return strings.Replace(s, ",", "=2C", -1)
+}
+
+func scramAttrs(s string) map[string]string {
+	attrs := map[string]string{}
+	for _, attr := range strings.Split(s, ",") {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) == 2 && len(kv[0]) == 1 {
+			attrs[kv[0]] = kv[1]
+		}
+	}
+	return attrs
+}
+
+// pbkdf2 derives a key of the hash size from password (RFC 2898), which is Hi() in RFC 5802.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iter int) []byte {
+	mac := hmac.New(h, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+
+	key := make([]byte, len(u))
+	copy(key, u)
+	for i := 1; i < iter; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
@@ -0,0 +1,84 @@
+// scram test
+package client
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"testing"
+)
+
+// scramExchange runs the exchange of RFC 5802 5 with the client nonce and the
+// server messages given, returning the client final message.
+func scramExchange(t *testing.T, name string, h func() hash.Hash, password, nonce, serverFirst, serverFinal string) (string, error) {
+	a := newScramAuth(name, h, false)
+	first, err := a.Start(&SaslInfo{User: "user", Password: password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(first), "n,,n=user,r="+a.clientNonce; got != want {
+		t.Errorf("%s: got client first message %q, want %q", name, got, want)
+	}
+	a.clientNonce = nonce
+	a.clientFirstBare = "n=user,r=" + nonce
+
+	final, err := a.Next([]byte(serverFirst), true)
+	if err != nil {
+		return "", err
+	}
+	if _, err := a.Next([]byte(serverFinal), false); err != nil {
+		return string(final), err
+	}
+	return string(final), nil
+}
+
+func TestScram(t *testing.T) {
+	for _, tt := range []struct {
+		name                                         string
+		h                                            func() hash.Hash
+		nonce, serverFirst, clientFinal, serverFinal string
+	}{
+		// RFC 5802 5
+		{"SCRAM-SHA-1", sha1.New, "fyko+d2lbbFgONRv9qkxdawL",
+			"r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			"c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			"v=rmF9pqV8S7suAoZWja4dJRkFsKQ="},
+		// RFC 7677 3
+		{"SCRAM-SHA-256", sha256.New, "rOprNGfwEbeRWgbNEkqO",
+			"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="},
+	} {
+		final, err := scramExchange(t, tt.name, tt.h, "pencil", tt.nonce, tt.serverFirst, tt.serverFinal)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if final != tt.clientFinal {
+			t.Errorf("%s: got client final message %q, want %q", tt.name, final, tt.clientFinal)
+		}
+		if _, err := scramExchange(t, tt.name, tt.h, "pencil", tt.nonce, tt.serverFirst, "v=AAAA"); err == nil {
+			t.Errorf("%s: wrong server signature accepted", tt.name)
+		}
+	}
+}
+
+func TestScramPassword(t *testing.T) {
+	const nonce, serverFirst = "fyko+d2lbbFgONRv9qkxdawL",
+		"r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096"
+
+	// the passwords are prepared as OpaqueString: NFC, and the spaces mapped to U+0020.
+	for _, equal := range [][2]string{
+		{"p\u00e9ncil", "pe\u0301ncil"},
+		{"pen cil", "pen\u00a0cil"},
+	} {
+		want, _ := scramExchange(t, "SCRAM-SHA-1", sha1.New, equal[0], nonce, serverFirst, "")
+		got, _ := scramExchange(t, "SCRAM-SHA-1", sha1.New, equal[1], nonce, serverFirst, "")
+		if got != want {
+			t.Errorf("password %+q: got %q, want the proof of %+q", equal[1], got, equal[0])
+		}
+	}
+
+	if _, err := scramExchange(t, "SCRAM-SHA-1", sha1.New, "pen\u0007cil", nonce, serverFirst, ""); err == nil {
+		t.Error("password with a control character accepted")
+	}
+}
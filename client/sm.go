@@ -0,0 +1,255 @@
+// sm
+package client
+
+import (
+	"errors"
+	"fmt"
+	xmpp "github.com/ginuerzh/goxmpp"
+	"github.com/ginuerzh/goxmpp/core"
+	"sync"
+)
+
+var (
+	ErrNoStreamManagement = errors.New("xmpp: stream management is not enabled")
+	ErrNotAcked           = errors.New("xmpp: stanza not acknowledged by the server")
+)
+
+// trackedStanza is a stanza whose acknowledgement is reported to the sender.
+type trackedStanza struct {
+	xmpp.Stan
+	acked chan error
+}
+
+type smPending struct {
+	e     xmpp.Element
+	acked chan error
+}
+
+// streamManagement is the state of a XEP-0198 session.
+type streamManagement struct {
+	id       string // resumption id, empty if the session cannot be resumed
+	inbound  uint32 // stanzas handled from the server
+	outbound uint32 // stanzas sent to the server
+	unacked  []*smPending
+	lock     sync.Mutex
+}
+
+func newStreamManagement(enabled *core.SmEnabled) *streamManagement {
+	sm := &streamManagement{}
+	if enabled.Resume {
+		sm.id = enabled.Id
+	}
+	return sm
+}
+
+// sent counts a stanza sent to the server and keeps it until acknowledged.
+func (sm *streamManagement) sent(e xmpp.Element, acked chan error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	sm.outbound++
+	sm.unacked = append(sm.unacked, &smPending{e: e, acked: acked})
+}
+
+// received counts a stanza handled from the server, returning the new count.
+func (sm *streamManagement) received() uint32 {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	sm.inbound++
+	return sm.inbound
+}
+
+func (sm *streamManagement) handled() uint32 {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	return sm.inbound
+}
+
+// ack drops the stanzas acknowledged by h, the count of stanzas handled by the server.
+func (sm *streamManagement) ack(h uint32) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	n := h - (sm.outbound - uint32(len(sm.unacked)))
+	if n > uint32(len(sm.unacked)) {
+		// the server acknowledges stanzas it never got, or old ones.
+		return
+	}
+	for _, p := range sm.unacked[:n] {
+		if p.acked != nil {
+			p.acked <- nil
+		}
+	}
+	sm.unacked = sm.unacked[n:]
+}
+
+// takeUnacked returns and forgets the stanzas not yet acknowledged, to be resent.
+func (sm *streamManagement) takeUnacked() []*smPending {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	pending := sm.unacked
+	sm.unacked = nil
+	sm.outbound -= uint32(len(pending))
+	return pending
+}
+
+func isStanza(e xmpp.Element) bool {
+	switch e.Name() {
+	case "iq", "message", "presence":
+		return true
+	}
+	return false
+}
+
+// SendAcked sends the stanza like Send, and returns a channel that receives nil
+// once the server acknowledges it (XEP-0198), or an error if it is lost.
+// The acknowledgement survives session resumption.
+func (c *Client) SendAcked(st xmpp.Stan) <-chan error {
+	ch := make(chan error, 1)
+	c.smLock.Lock()
+	sm := c.sm
+	c.smLock.Unlock()
+	if sm == nil {
+		ch <- ErrNoStreamManagement
+		return ch
+	}
+	if err := c.Send(&trackedStanza{Stan: st, acked: ch}); err != nil {
+		ch <- err
+	}
+	return ch
+}
+
+// setSM sets the stream management session. It is only called by Run, which
+// reads c.sm without locking.
+func (c *Client) setSM(sm *streamManagement) {
+	c.smLock.Lock()
+	defer c.smLock.Unlock()
+	c.sm = sm
+}
+
+// write sends an element to the server, counting the stanzas when stream
+// management is enabled.
+func (c *Client) write(e xmpp.Element) error {
+	var acked chan error
+	if t, ok := e.(*trackedStanza); ok {
+		e, acked = t.Stan, t.acked
+	}
+
+	c.trackPresence(e)
+	if c.sm != nil && isStanza(e) {
+		c.sm.sent(e, acked)
+	} else if acked != nil {
+		acked <- ErrNoStreamManagement
+	}
+	return c.send(e)
+}
+
+// handleSM handles the stream management elements received out of stanzas.
+// It returns false if e is not one of them.
+func (c *Client) handleSM(e xmpp.Element) bool {
+	switch v := e.(type) {
+	case *core.SmRequest:
+		// answered by Run, without blocking if an answer is already pending.
+		select {
+		case c.ackChan <- struct{}{}:
+		default:
+		}
+	case *core.SmAck:
+		if c.sm != nil {
+			c.sm.ack(v.H)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// enableSM enables stream management after resource binding.
+func (c *Client) enableSM() error {
+	e, err := c.request(&core.SmEnable{Resume: true})
+	if err != nil {
+		return err
+	}
+	switch v := e.(type) {
+	case *core.SmEnabled:
+		c.setSM(newStreamManagement(v))
+	case *core.SmFailed:
+		if c.Opts.Debug {
+			fmt.Println(v)
+		}
+	default:
+		return errors.New("sm: unexpected <" + e.Name() + ">")
+	}
+	return nil
+}
+
+// resumable tells whether there is a previous session to resume.
+func (c *Client) resumable() bool {
+	return c.sm != nil && c.sm.id != ""
+}
+
+// resumeSM resumes the previous session, returning false if the server refuses.
+func (c *Client) resumeSM() (bool, error) {
+	e, err := c.request(&core.SmResume{H: c.sm.handled(), Previd: c.sm.id})
+	if err != nil {
+		return false, err
+	}
+	switch v := e.(type) {
+	case *core.SmResumed:
+		return true, c.resumed(v)
+	case *core.SmFailed:
+		c.resumeFailed(v.H)
+		return false, nil
+	}
+	return false, errors.New("sm: unexpected <" + e.Name() + ">")
+}
+
+// resumed resends the stanzas the server did not get before the connection was lost.
+func (c *Client) resumed(resumed *core.SmResumed) error {
+	c.smResumed = true
+	c.sm.ack(resumed.H)
+	for _, p := range c.sm.takeUnacked() {
+		c.sm.sent(p.e, p.acked)
+		if err := c.send(p.e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeFailed ends the previous session, keeping its unacknowledged stanzas
+// to be sent again in the new one by resendUnacked. h is the count of stanzas
+// handled by the server, if known.
+func (c *Client) resumeFailed(h *uint32) {
+	if c.sm == nil {
+		return
+	}
+	if h != nil {
+		c.sm.ack(*h)
+	}
+	c.smResend = c.sm.takeUnacked()
+	c.setSM(nil)
+}
+
+// resendUnacked sends the stanzas left unacknowledged by a session that could not be resumed.
+func (c *Client) resendUnacked() error {
+	pending := c.smResend
+	c.smResend = nil
+	for _, p := range pending {
+		if c.sm != nil {
+			c.sm.sent(p.e, p.acked)
+		} else if p.acked != nil {
+			p.acked <- ErrNotAcked
+		}
+		if p.e == xmpp.Element(c.presence) {
+			c.presenceResent = true
+		}
+		if err := c.send(p.e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// sm test
+package client
+
+import (
+	xmpp "github.com/ginuerzh/goxmpp"
+	"testing"
+)
+
+// TestSASL2EnableSM authenticates with SASL2 without Bind 2: stream management
+// is enabled after binding, and the stanzas sent with SendAcked are acknowledged.
+func TestSASL2EnableSM(t *testing.T) {
+	c := newFakeClient(t, &Options{StreamManagement: true}, func(s *fakeServer) error {
+		if err := s.openStream("<authentication xmlns='urn:xmpp:sasl:2'><mechanism>PLAIN</mechanism>" +
+			"<inline><sm xmlns='urn:xmpp:sm:3'/></inline></authentication>"); err != nil {
+			return err
+		}
+		if _, err := s.expect("authenticate"); err != nil {
+			return err
+		}
+		if err := s.write("<success xmlns='urn:xmpp:sasl:2'>" +
+			"<authorization-identifier>juliet@example.com</authorization-identifier></success>"); err != nil {
+			return err
+		}
+		if err := s.bind("juliet@example.com/balcony"); err != nil {
+			return err
+		}
+		if _, err := s.expect("enable"); err != nil {
+			return err
+		}
+		if err := s.write("<enabled xmlns='urn:xmpp:sm:3'/>"); err != nil {
+			return err
+		}
+		if _, err := s.expect("message"); err != nil {
+			return err
+		}
+		return s.write("<a xmlns='urn:xmpp:sm:3' h='1'/>")
+	})
+	c.start()
+
+	c.login()
+	if err := <-c.SendAcked(xmpp.NewMessage("chat", "romeo@example.com", "hi", "")); err != nil {
+		t.Fatal("SendAcked:", err)
+	}
+	c.wait()
+	c.stop()
+}
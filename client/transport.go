@@ -0,0 +1,232 @@
+// transport
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	xmpp "github.com/ginuerzh/goxmpp"
+	"io"
+	"net"
+	"time"
+)
+
+// Transport carries the XML stream between the client and the server.
+// The built-in transports are TCP (with STARTTLS or direct TLS), WebSocket and BOSH,
+// selected by Options; NewStreamTransport makes one from any connection, such as
+// an in-memory pipe, to be returned by Options.Dial.
+type Transport interface {
+	// OpenStream opens the stream to the domain and reads the stream header of the server.
+	OpenStream(domain string) error
+	// RestartStream opens a new stream after STARTTLS or SASL (RFC 6120 4.3.3).
+	RestartStream() error
+	// ReadElement reads the next top-level element of the stream.
+	ReadElement() (xmpp.Element, error)
+	// WriteElement writes an element to the stream.
+	WriteElement(e xmpp.Element) error
+	// StartTLS upgrades the connection to TLS, once the server is ready to proceed.
+	StartTLS(config *tls.Config) (*tls.ConnectionState, error)
+	// ConnectionState returns the state of the TLS connection, nil if not encrypted.
+	ConnectionState() *tls.ConnectionState
+	// Close closes the stream and the connection.
+	Close() error
+}
+
+var ErrStartTLSUnsupported = errors.New("xmpp: STARTTLS is not supported by the transport")
+
+// xmlStream reads and writes the elements of a stream carried by a connection.
+type xmlStream struct {
+	conn *Conn
+	dec  *xml.Decoder
+	enc  *xml.Encoder
+	// whether each element is written at once, as a message of its own
+	framed bool
+	// the prefixes declared by the stream header, in scope of the elements read
+	ns []xml.Attr
+}
+
+func newXMLStream(conn net.Conn, logger io.Writer, framed bool) *xmlStream {
+	s := &xmlStream{conn: NewConn(conn, logger), framed: framed}
+	s.reset()
+	return s
+}
+
+// reset reads and writes a new stream, a document of its own rather than one
+// nested in the previous stream.
+func (s *xmlStream) reset() {
+	s.dec = xml.NewDecoder(s.conn)
+	s.enc = xml.NewEncoder(s.conn)
+	s.ns = nil
+}
+
+func (s *xmlStream) ReadElement() (xmpp.Element, error) {
+	se, err := nextStart(s.dec)
+	if err != nil {
+		return nil, err
+	}
+
+	elem := xmpp.E(se.Name.Space + " " + se.Name.Local)
+	if elem == nil {
+		elem = &xmpp.RawElement{}
+	}
+	switch elem.Name() {
+	case "iq", "message", "presence":
+		st, err := decodeStan(s.dec, &se)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range st.E() {
+			s.inScope(e)
+		}
+		return st, nil
+	}
+
+	if err := s.dec.DecodeElement(elem, &se); err != nil {
+		return nil, err
+	}
+	s.inScope(elem)
+	return elem, nil
+}
+
+// inScope adds the prefixes declared by the stream header to a raw element,
+// which may use them.
+func (s *xmlStream) inScope(e xmpp.Element) {
+	if raw, ok := e.(*xmpp.RawElement); ok {
+		raw.NS = append(raw.NS, s.ns...)
+	}
+}
+
+func (s *xmlStream) WriteElement(e xmpp.Element) error {
+	if s.framed {
+		b, err := xml.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return s.writeRaw(b)
+	}
+	return s.enc.Encode(e)
+}
+
+func (s *xmlStream) writeRaw(data []byte) error {
+	_, err := s.conn.Write(data)
+	return err
+}
+
+// SetDeadline sets the deadline of the I/O on the connection, see watchContext.
+func (s *xmlStream) SetDeadline(t time.Time) error {
+	return s.conn.c.SetDeadline(t)
+}
+
+// streamTransport carries the stream as is on a connection (RFC 6120).
+type streamTransport struct {
+	*xmlStream
+	domain string
+}
+
+// NewStreamTransport returns the transport of the stream over conn, like a TCP
+// or TLS connection, or one end of net.Pipe.
+func NewStreamTransport(conn net.Conn) Transport {
+	return newStreamTransport(conn, nil)
+}
+
+func newStreamTransport(conn net.Conn, logger io.Writer) *streamTransport {
+	return &streamTransport{xmlStream: newXMLStream(conn, logger, false)}
+}
+
+func (t *streamTransport) OpenStream(domain string) error {
+	t.domain = domain
+	if err := t.writeRaw(streamElement(domain)); err != nil {
+		return err
+	}
+
+	se, err := nextStart(t.dec)
+	if err != nil {
+		return err
+	}
+	if se.Name.Space != "http://etherx.jabber.org/streams" || se.Name.Local != "stream" {
+		return errors.New("xmpp: unexpected <" + se.Name.Local + "> instead of the stream header")
+	}
+	for _, attr := range se.Attr {
+		if attr.Name.Space == "xmlns" {
+			t.ns = append(t.ns, attr)
+		}
+	}
+	return nil
+}
+
+func (t *streamTransport) RestartStream() error {
+	t.reset()
+	return t.OpenStream(t.domain)
+}
+
+func (t *streamTransport) StartTLS(config *tls.Config) (*tls.ConnectionState, error) {
+	tlsconn, err := tlsHandShake(context.Background(), t.conn.c, config)
+	if err != nil {
+		return nil, err
+	}
+	t.conn.c = tlsconn
+	return t.ConnectionState(), nil
+}
+
+func (t *streamTransport) ConnectionState() *tls.ConnectionState {
+	conn := t.conn.c
+	if c, ok := conn.(*compressConn); ok {
+		conn = c.Conn
+	}
+	if tlsconn, ok := conn.(*tls.Conn); ok {
+		if state := tlsconn.ConnectionState(); state.HandshakeComplete {
+			return &state
+		}
+	}
+	return nil
+}
+
+func (t *streamTransport) Compress() error {
+	t.conn.c = newCompressConn(t.conn.c)
+	return nil
+}
+
+func (t *streamTransport) CompressionStats() (CompressionStats, bool) {
+	if c, ok := t.conn.c.(*compressConn); ok {
+		return c.Stats(), true
+	}
+	return CompressionStats{}, false
+}
+
+func (t *streamTransport) Close() error {
+	t.writeRaw([]byte("</stream:stream>"))
+	return t.conn.Close()
+}
+
+func streamElement(domain string) []byte {
+	return []byte("<stream:stream " +
+		"xmlns='jabber:client' " +
+		"xmlns:stream='http://etherx.jabber.org/streams' " +
+		"version='1.0'" +
+		" to='" + domain + "'>")
+}
+
+// Scan XML token stream to find next StartElement.
+func nextStart(p *xml.Decoder) (xml.StartElement, error) {
+	for {
+		t, err := p.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			return xml.StartElement{}, errors.New("Unexpected end element: " + t.Name.Local)
+		}
+	}
+}
+
+func decodeStan(dec *xml.Decoder, start *xml.StartElement) (xmpp.Stan, error) {
+	st := xmpp.NewStanza(start.Name.Local)
+	if err := dec.DecodeElement(st, start); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
@@ -0,0 +1,223 @@
+// transport test
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	xmpp "github.com/ginuerzh/goxmpp"
+	"github.com/ginuerzh/goxmpp/xep"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeServer is the server end of a connection to a client.
+type fakeServer struct {
+	conn net.Conn
+	dec  *xml.Decoder
+}
+
+// fakeElement is an element received by a fakeServer.
+type fakeElement struct {
+	XMLName xml.Name
+	Attr    []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+func (e *fakeElement) attr(name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// openStream reads the stream header of the client and answers with the features.
+func (s *fakeServer) openStream(features string) error {
+	s.dec = xml.NewDecoder(s.conn)
+	for {
+		t, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			if se.Name.Local != "stream" {
+				return errors.New("unexpected <" + se.Name.Local + "> instead of the stream header")
+			}
+			break
+		}
+	}
+	return s.write("<?xml version='1.0'?><stream:stream xmlns='jabber:client'"+
+		" xmlns:stream='http://etherx.jabber.org/streams' from='example.com' id='s1' version='1.0'>"+
+		"<stream:features>%s</stream:features>", features)
+}
+
+func (s *fakeServer) read() (*fakeElement, error) {
+	e := &fakeElement{}
+	return e, s.dec.Decode(e)
+}
+
+// expect reads the next element, which must have the local name, skipping the
+// acknowledgement requests of stream management.
+func (s *fakeServer) expect(name string) (*fakeElement, error) {
+	e, err := s.read()
+	for err == nil && e.XMLName.Local == "r" && name != "r" {
+		e, err = s.read()
+	}
+	if err == nil && e.XMLName.Local != name {
+		err = errors.New("unexpected <" + e.XMLName.Local + "> instead of <" + name + ">")
+	}
+	return e, err
+}
+
+func (s *fakeServer) write(format string, a ...interface{}) error {
+	_, err := fmt.Fprintf(s.conn, format, a...)
+	return err
+}
+
+// login authenticates the client and binds the resource of jid.
+func (s *fakeServer) login(jid string) error {
+	if err := s.auth(""); err != nil {
+		return err
+	}
+	return s.bind(jid)
+}
+
+// auth authenticates the client with PLAIN, juliet:secret, then offers resource
+// binding and the features.
+func (s *fakeServer) auth(features string) error {
+	if err := s.openStream("<mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'>" +
+		"<mechanism>PLAIN</mechanism></mechanisms>"); err != nil {
+		return err
+	}
+	auth, err := s.expect("auth")
+	if err != nil {
+		return err
+	}
+	if b, _ := base64.StdEncoding.DecodeString(auth.Inner); string(b) != "\x00juliet\x00secret" {
+		s.write("<failure xmlns='urn:ietf:params:xml:ns:xmpp-sasl'><not-authorized/></failure>")
+		return errors.New("authentication failed")
+	}
+	if err := s.write("<success xmlns='urn:ietf:params:xml:ns:xmpp-sasl'/>"); err != nil {
+		return err
+	}
+
+	return s.openStream("<bind xmlns='urn:ietf:params:xml:ns:xmpp-bind'/>" + features)
+}
+
+// bind binds the resource of jid.
+func (s *fakeServer) bind(jid string) error {
+	iq, err := s.expect("iq")
+	if err != nil {
+		return err
+	}
+	return s.write("<iq type='result' id='%s'><bind xmlns='urn:ietf:params:xml:ns:xmpp-bind'>"+
+		"<jid>%s</jid></bind></iq>", iq.attr("id"), jid)
+}
+
+// fakeClient is a client of juliet@example.com connected with a pipe to a fake
+// server.
+type fakeClient struct {
+	*Client
+	t      *testing.T
+	dialed string     // the domain of the last dial
+	logins chan error // of OnLogined
+	done   chan error // the result of the server script
+	run    chan error // of Run, once started
+}
+
+// newFakeClient returns a client of the options connecting to a fake server
+// running script, ready to be started. The server gives up after 10 seconds.
+func newFakeClient(t *testing.T, opts *Options, script func(s *fakeServer) error) *fakeClient {
+	conn, srv := net.Pipe()
+	srv.SetDeadline(time.Now().Add(10 * time.Second))
+	c := &fakeClient{
+		t:      t,
+		logins: make(chan error, 2),
+		done:   make(chan error, 1),
+		run:    make(chan error, 1),
+	}
+	go func() {
+		c.done <- script(&fakeServer{conn: srv})
+		io.Copy(io.Discard, srv)
+	}()
+
+	opts.Security = SecurityNone
+	opts.Dial = func(ctx context.Context, domain string) (Transport, error) {
+		c.dialed = domain
+		return NewStreamTransport(conn), nil
+	}
+	c.Client = NewClient("", "juliet@example.com", "secret", opts)
+	c.OnLogined(func(err error) { c.logins <- err })
+	t.Cleanup(func() { c.Client.Close() })
+	return c
+}
+
+// start runs the client.
+func (c *fakeClient) start() {
+	go func() { c.run <- c.Run() }()
+}
+
+// login waits for the client to log in.
+func (c *fakeClient) login() {
+	c.t.Helper()
+	if err := <-c.logins; err != nil {
+		c.t.Fatal("login:", err)
+	}
+}
+
+// wait waits for the end of the server script.
+func (c *fakeClient) wait() {
+	c.t.Helper()
+	if err := <-c.done; err != nil {
+		c.t.Fatal("server:", err)
+	}
+}
+
+// stop closes the client, checking that Run returns.
+func (c *fakeClient) stop() {
+	c.t.Helper()
+	c.Close()
+	if err := <-c.run; err != nil {
+		c.t.Errorf("Run returned %v after Close", err)
+	}
+}
+
+func TestDialStreamTransport(t *testing.T) {
+	c := newFakeClient(t, &Options{}, func(s *fakeServer) error {
+		if err := s.login("juliet@example.com/balcony"); err != nil {
+			return err
+		}
+		// unknown top-level elements are ignored.
+		if err := s.write("<foo xmlns='urn:example:foo'/>"); err != nil {
+			return err
+		}
+		ping, err := s.expect("iq")
+		if err != nil {
+			return err
+		}
+		return s.write("<iq type='result' id='%s' from='example.com'/>", ping.attr("id"))
+	})
+	c.start()
+
+	iq, err := c.SendIQ(xmpp.NewIQ("get", "", "example.com", &xep.Ping{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iq.Type() != "result" {
+		t.Errorf("got IQ of type %q, want result", iq.Type())
+	}
+	c.wait()
+	c.stop()
+	if c.dialed != "example.com" {
+		t.Errorf("dialed %q, want example.com", c.dialed)
+	}
+	if got := c.Jid.String(); got != "juliet@example.com/balcony" {
+		t.Errorf("bound %q, want juliet@example.com/balcony", got)
+	}
+}
@@ -2,113 +2,87 @@
 package client
 
 import (
-	"crypto/md5"
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"encoding/base64"
-	"fmt"
-	"math/big"
 	"net"
-	"strconv"
-	"strings"
 	"time"
 )
 
-func tlsHandShake(conn net.Conn, host string, config *tls.Config) (net.Conn, error) {
-	tlsconn := tls.Client(conn, config)
-	if err := tlsconn.Handshake(); err != nil {
-		return nil, err
+// tlsConfig returns a copy of config to connect to domain. The certificate is verified
+// against the XMPP domain rather than the host connected to (RFC 6120 13.7.2.1),
+// unless config specifies a ServerName. Direct TLS connections announce the
+// "xmpp-client" ALPN protocol (XEP-0368).
+func tlsConfig(config *tls.Config, domain string, direct bool) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
 	}
-
-	if strings.LastIndex(host, ":") > 0 {
-		host = host[:strings.LastIndex(host, ":")]
+	if config.ServerName == "" {
+		config.ServerName = domain
 	}
-	if err := tlsconn.VerifyHostname(host); err != nil {
-		return nil, err
+	if direct && len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"xmpp-client"}
 	}
-
-	return tlsconn, nil
+	return config
 }
 
-func saslAuthPlain(username, password string) string {
-	raw := "\x00" + username + "\x00" + password
-	enc := make([]byte, base64.StdEncoding.EncodedLen(len(raw)))
-	base64.StdEncoding.Encode(enc, []byte(raw))
+func tlsHandShake(ctx context.Context, conn net.Conn, config *tls.Config) (*tls.Conn, error) {
+	tlsconn := tls.Client(conn, config)
+	if err := tlsconn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
 
-	return string(enc)
+	return tlsconn, nil
 }
 
-func saslAuthDigestMd5(change string, domain, username, password string) string {
-	b, err := base64.StdEncoding.DecodeString(change)
-	if err != nil {
-		return ""
+// contextError returns ErrTimeout if the deadline of the context is exceeded,
+// and the error of the context otherwise.
+func contextError(err error) error {
+	if err == context.DeadlineExceeded {
+		return ErrTimeout
 	}
-
-	tokens := map[string]string{}
-	for _, token := range strings.Split(string(b), ",") {
-		kv := strings.SplitN(strings.TrimSpace(token), "=", 2)
-		if len(kv) == 2 {
-			if kv[1][0] == '"' && kv[1][len(kv[1])-1] == '"' {
-				kv[1] = kv[1][1 : len(kv[1])-1]
-			}
-			tokens[kv[0]] = kv[1]
-		}
-	}
-	realm, _ := tokens["realm"]
-	nonce, _ := tokens["nonce"]
-	qop, _ := tokens["qop"]
-	charset, _ := tokens["charset"]
-	cnonceStr := cnonce()
-	digestUri := "xmpp/" + domain
-	nonceCount := fmt.Sprintf("%08x", 1)
-	digest := saslDigestResponse(username, realm, password,
-		nonce, cnonceStr, "AUTHENTICATE", digestUri, nonceCount)
-	message := "username=" + username +
-		", realm=" + realm +
-		", nonce=" + nonce +
-		", cnonce=" + cnonceStr +
-		", nc=" + nonceCount +
-		", qop=" + qop +
-		", digest-uri=" + digestUri +
-		", response=" + digest +
-		", charset=" + charset
-
-	return base64.StdEncoding.EncodeToString([]byte(message))
+	return err
 }
 
-func cnonce() string {
-	randSize := big.NewInt(0)
-	randSize.Lsh(big.NewInt(1), 64)
-	cn, err := rand.Int(rand.Reader, randSize)
-	if err != nil {
-		return ""
-	}
-	return fmt.Sprintf("%016x", cn)
+// deadliner is implemented by the transports whose I/O can be interrupted.
+type deadliner interface {
+	SetDeadline(t time.Time) error
 }
 
-func saslDigestResponse(username, realm, passwd, nonce, cnonceStr,
-	authenticate, digestUri, nonceCountStr string) string {
-	h := func(text string) []byte {
-		h := md5.New()
-		h.Write([]byte(text))
-		return h.Sum(nil)
-	}
-	hex := func(bytes []byte) string {
-		return fmt.Sprintf("%x", bytes)
-	}
-	kd := func(secret, data string) []byte {
-		return h(secret + ":" + data)
+// watchContext makes the pending and future I/O on conn fail once ctx is done,
+// until stop is called.
+func watchContext(ctx context.Context, conn deadliner) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
 	}
 
-	a1 := string(h(username+":"+realm+":"+passwd)) + ":" +
-		nonce + ":" + cnonceStr
-	a2 := authenticate + ":" + digestUri
-	response := hex(kd(hex(h(a1)), nonce+":"+
-		nonceCountStr+":"+cnonceStr+":auth:"+
-		hex(h(a2))))
-	return response
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+		conn.SetDeadline(time.Time{})
+	}
 }
 
+// GenId returns a random stanza ID, unique without coordination: 96 bits
+// from crypto/rand, base64url encoded.
 func GenId() string {
-	return strconv.Itoa(time.Now().Nanosecond())
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic("xmpp: reading random ID: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
 }
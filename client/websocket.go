@@ -0,0 +1,365 @@
+// websocket
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ginuerzh/goxmpp/core"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes (RFC 6455 5.2)
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// wsConn is a WebSocket connection (RFC 6455) with the "xmpp" subprotocol (RFC 7395).
+// Read returns the payloads of the messages one after the other, Write sends p
+// as one text message: each write must be a complete XML element.
+type wsConn struct {
+	net.Conn
+	br        *bufio.Reader
+	remaining uint64 // unread bytes of the current frame
+	mask      []byte // mask of the current frame, if any
+	pos       int    // position in the mask
+
+	wlock  sync.Mutex
+	closed bool // a close frame has been sent
+}
+
+// newWebSocket performs the opening handshake on conn, returning the WebSocket connection.
+func newWebSocket(ctx context.Context, conn net.Conn, u *url.URL) (*wsConn, error) {
+	stop := watchContext(ctx, conn)
+	defer stop()
+
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(b)
+
+	req := &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Opaque: u.RequestURI()},
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":                {"websocket"},
+			"Connection":             {"Upgrade"},
+			"Sec-Websocket-Key":      {key},
+			"Sec-Websocket-Version":  {"13"},
+			"Sec-Websocket-Protocol": {"xmpp"},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, errors.New("websocket: handshake failed: " + resp.Status)
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		resp.Header.Get("Sec-Websocket-Accept") != wsAccept(key) {
+		return nil, errors.New("websocket: invalid handshake response")
+	}
+	if resp.Header.Get("Sec-Websocket-Protocol") != "xmpp" {
+		return nil, errors.New("websocket: server does not support the xmpp subprotocol")
+	}
+
+	return &wsConn{Conn: conn, br: br}, nil
+}
+
+func wsAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	c.unmask(p[:n])
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// nextFrame reads the header of the next data frame, handling the control frames before it.
+func (c *wsConn) nextFrame() error {
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(c.br, h[:]); err != nil {
+			return err
+		}
+		opcode := h[0] & 0x0f
+
+		length := uint64(h[1] & 0x7f)
+		switch length {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(c.br, b[:]); err != nil {
+				return err
+			}
+			length = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(c.br, b[:]); err != nil {
+				return err
+			}
+			length = binary.BigEndian.Uint64(b[:])
+		}
+
+		// servers must not mask their frames, but it costs nothing to accept them.
+		c.mask, c.pos = nil, 0
+		if h[1]&0x80 != 0 {
+			c.mask = make([]byte, 4)
+			if _, err := io.ReadFull(c.br, c.mask); err != nil {
+				return err
+			}
+		}
+
+		switch opcode {
+		case wsContinuation, wsText, wsBinary:
+			c.remaining = length
+			return nil
+		}
+
+		if length > 125 {
+			return errors.New("websocket: control frame too long")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		c.unmask(payload)
+
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return err
+			}
+		case wsClose:
+			c.writeClose()
+			return io.EOF
+		}
+	}
+}
+
+func (c *wsConn) unmask(b []byte) {
+	if c.mask == nil {
+		return
+	}
+	for i := range b {
+		b[i] ^= c.mask[c.pos%4]
+		c.pos++
+	}
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(wsText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame writes an unfragmented frame, masked as required from clients.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+
+	if c.closed {
+		return errors.New("websocket: connection closed")
+	}
+	if opcode == wsClose {
+		c.closed = true
+	}
+
+	b := []byte{0x80 | opcode, 0x80}
+	switch n := len(payload); {
+	case n < 126:
+		b[1] |= byte(n)
+	case n <= 0xffff:
+		b[1] |= 126
+		b = append(b, byte(n>>8), byte(n))
+	default:
+		b[1] |= 127
+		b = append(b, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(n))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(rand.Reader, mask); err != nil {
+		return err
+	}
+	b = append(b, mask...)
+	for i, v := range payload {
+		b = append(b, v^mask[i%4])
+	}
+
+	_, err := c.Conn.Write(b)
+	return err
+}
+
+// writeClose sends a normal closure frame, if not already sent.
+func (c *wsConn) writeClose() error {
+	c.wlock.Lock()
+	closed := c.closed
+	c.wlock.Unlock()
+	if closed {
+		return nil
+	}
+	return c.writeFrame(wsClose, []byte{0x03, 0xe8})
+}
+
+func (c *wsConn) Close() error {
+	c.writeClose()
+	return c.Conn.Close()
+}
+
+// dialWebSocket connects to the WebSocket endpoint of the domain: Options.WebSocketURL,
+// or the ones discovered with XEP-0156.
+func (c *Client) dialWebSocket(ctx context.Context, domain string) error {
+	urls := []string{c.Opts.WebSocketURL}
+	if c.Opts.WebSocketURL == "" {
+		var err error
+		if urls, err = lookupHostMeta(ctx, c.httpClient(), domain, relWebSocket); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	for _, rawurl := range urls {
+		if err = c.dialWebSocketURL(ctx, rawurl); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return contextError(ctx.Err())
+		}
+		if c.Opts.Debug {
+			fmt.Println("connect", rawurl, "failed:", err)
+		}
+	}
+	return err
+}
+
+func (c *Client) dialWebSocketURL(ctx context.Context, rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+
+	var port string
+	switch u.Scheme {
+	case "ws":
+		port = "80"
+	case "wss":
+		port = "443"
+	default:
+		return errors.New("websocket: unsupported url: " + rawurl)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	conn, err := c.connect(ctx, addr)
+	if err != nil {
+		return err
+	}
+
+	var state *tls.ConnectionState
+	if u.Scheme == "wss" {
+		// the certificate is the one of the web server, verified against its host.
+		tlsconn, err := tlsHandShake(ctx, conn, tlsConfig(c.Opts.TlsConfig, u.Hostname(), false))
+		if err != nil {
+			return err
+		}
+		s := tlsconn.ConnectionState()
+		state = &s
+		conn = tlsconn
+	}
+
+	ws, err := newWebSocket(ctx, conn, u)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return c.setTransport(&wsTransport{xmlStream: newXMLStream(ws, c.logger(), true), tlsState: state})
+}
+
+// wsTransport carries the stream over WebSocket, one element per message (RFC 7395 3.3.3).
+type wsTransport struct {
+	*xmlStream
+	domain   string
+	tlsState *tls.ConnectionState
+}
+
+func (t *wsTransport) OpenStream(domain string) error {
+	t.domain = domain
+	if err := t.writeRaw([]byte("<open xmlns='urn:ietf:params:xml:ns:xmpp-framing' " +
+		"version='1.0' to='" + domain + "'/>")); err != nil {
+		return err
+	}
+
+	e, err := t.ReadElement()
+	if err != nil {
+		return err
+	}
+	switch v := e.(type) {
+	case *core.FramingOpen:
+		return nil
+	case *core.FramingClose:
+		return v
+	}
+	return errors.New("websocket: unexpected <" + e.Name() + "> instead of <open/>")
+}
+
+func (t *wsTransport) RestartStream() error {
+	return t.OpenStream(t.domain)
+}
+
+func (t *wsTransport) StartTLS(config *tls.Config) (*tls.ConnectionState, error) {
+	return nil, ErrStartTLSUnsupported
+}
+
+func (t *wsTransport) ConnectionState() *tls.ConnectionState {
+	return t.tlsState
+}
+
+func (t *wsTransport) Close() error {
+	t.writeRaw([]byte("<close xmlns='urn:ietf:params:xml:ns:xmpp-framing'/>"))
+	return t.conn.Close()
+}
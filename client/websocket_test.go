@@ -0,0 +1,40 @@
+// websocket test
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestWebSocketNotEncrypted fails to log in over a ws:// URL when encryption is
+// required, since STARTTLS is not available over WebSocket.
+func TestWebSocketNotEncrypted(t *testing.T) {
+	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + wsAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n" +
+			"Sec-WebSocket-Protocol: xmpp\r\n\r\n")
+		buf.Flush()
+		io.Copy(io.Discard, conn)
+	}))
+	defer ws.Close()
+
+	for _, mode := range []SecurityMode{SecurityStartTLS, SecurityDirectTLS} {
+		c := NewClient("", "juliet@example.com", "secret", &Options{
+			Security:     mode,
+			WebSocket:    true,
+			WebSocketURL: strings.Replace(ws.URL, "http://", "ws://", 1),
+		})
+		if err := c.Login(); err != ErrNotEncrypted {
+			t.Errorf("security %d: Login returned %v, want ErrNotEncrypted", mode, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// compress
+package core
+
+import (
+	"encoding/xml"
+)
+
+// XEP-0138: Stream Compression
+type Compress struct {
+	XMLName xml.Name `xml:"http://jabber.org/protocol/compress compress"`
+	Method  string   `xml:"method"`
+}
+
+func (_ Compress) Name() string {
+	return "compress"
+}
+
+func (_ Compress) FullName() string {
+	return "http://jabber.org/protocol/compress compress"
+}
+
+type Compressed struct {
+	XMLName xml.Name `xml:"http://jabber.org/protocol/compress compressed"`
+}
+
+func (_ Compressed) Name() string {
+	return "compressed"
+}
+
+func (_ Compressed) FullName() string {
+	return "http://jabber.org/protocol/compress compressed"
+}
+
+// CompressFailure is the failure to compress the stream: setup-failed,
+// processing-failed or unsupported-method.
+type CompressFailure struct {
+	XMLName xml.Name `xml:"http://jabber.org/protocol/compress failure"`
+	Reason  xml.Name `xml:",any"`
+}
+
+func (_ CompressFailure) Name() string {
+	return "failure"
+}
+
+func (_ CompressFailure) FullName() string {
+	return "http://jabber.org/protocol/compress failure"
+}
+
+func (f CompressFailure) Error() string {
+	return "compression failure: " + f.Reason.Local
+}
@@ -0,0 +1,204 @@
+// error conditions
+package core
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+const (
+	nsStreams = "urn:ietf:params:xml:ns:xmpp-streams"
+	nsStanzas = "urn:ietf:params:xml:ns:xmpp-stanzas"
+	nsXML     = "http://www.w3.org/XML/1998/namespace"
+)
+
+// StreamCondition is a defined condition of a stream error (RFC 6120 4.9.3).
+// It matches the stream errors of the condition with errors.Is.
+type StreamCondition string
+
+const (
+	StreamBadFormat              StreamCondition = "bad-format"
+	StreamBadNamespacePrefix     StreamCondition = "bad-namespace-prefix"
+	StreamConflict               StreamCondition = "conflict"
+	StreamConnectionTimeout      StreamCondition = "connection-timeout"
+	StreamHostGone               StreamCondition = "host-gone"
+	StreamHostUnknown            StreamCondition = "host-unknown"
+	StreamImproperAddressing     StreamCondition = "improper-addressing"
+	StreamInternalServerError    StreamCondition = "internal-server-error"
+	StreamInvalidFrom            StreamCondition = "invalid-from"
+	StreamInvalidNamespace       StreamCondition = "invalid-namespace"
+	StreamInvalidXML             StreamCondition = "invalid-xml"
+	StreamNotAuthorized          StreamCondition = "not-authorized"
+	StreamNotWellFormed          StreamCondition = "not-well-formed"
+	StreamPolicyViolation        StreamCondition = "policy-violation"
+	StreamRemoteConnectionFailed StreamCondition = "remote-connection-failed"
+	StreamReset                  StreamCondition = "reset"
+	StreamResourceConstraint     StreamCondition = "resource-constraint"
+	StreamRestrictedXML          StreamCondition = "restricted-xml"
+	StreamSeeOtherHost           StreamCondition = "see-other-host"
+	StreamSystemShutdown         StreamCondition = "system-shutdown"
+	StreamUndefinedCondition     StreamCondition = "undefined-condition"
+	StreamUnsupportedEncoding    StreamCondition = "unsupported-encoding"
+	StreamUnsupportedFeature     StreamCondition = "unsupported-feature"
+	StreamUnsupportedStanzaType  StreamCondition = "unsupported-stanza-type"
+	StreamUnsupportedVersion     StreamCondition = "unsupported-version"
+)
+
+func (c StreamCondition) Error() string {
+	return string(c)
+}
+
+// StanzaCondition is a defined condition of a stanza error (RFC 6120 8.3.3).
+// It matches the stanza errors of the condition with errors.Is.
+type StanzaCondition string
+
+const (
+	StanzaBadRequest            StanzaCondition = "bad-request"
+	StanzaConflict              StanzaCondition = "conflict"
+	StanzaFeatureNotImplemented StanzaCondition = "feature-not-implemented"
+	StanzaForbidden             StanzaCondition = "forbidden"
+	StanzaGone                  StanzaCondition = "gone"
+	StanzaInternalServerError   StanzaCondition = "internal-server-error"
+	StanzaItemNotFound          StanzaCondition = "item-not-found"
+	StanzaJidMalformed          StanzaCondition = "jid-malformed"
+	StanzaNotAcceptable         StanzaCondition = "not-acceptable"
+	StanzaNotAllowed            StanzaCondition = "not-allowed"
+	StanzaNotAuthorized         StanzaCondition = "not-authorized"
+	StanzaPolicyViolation       StanzaCondition = "policy-violation"
+	StanzaRecipientUnavailable  StanzaCondition = "recipient-unavailable"
+	StanzaRedirect              StanzaCondition = "redirect"
+	StanzaRegistrationRequired  StanzaCondition = "registration-required"
+	StanzaRemoteServerNotFound  StanzaCondition = "remote-server-not-found"
+	StanzaRemoteServerTimeout   StanzaCondition = "remote-server-timeout"
+	StanzaResourceConstraint    StanzaCondition = "resource-constraint"
+	StanzaServiceUnavailable    StanzaCondition = "service-unavailable"
+	StanzaSubscriptionRequired  StanzaCondition = "subscription-required"
+	StanzaUndefinedCondition    StanzaCondition = "undefined-condition"
+	StanzaUnexpectedRequest     StanzaCondition = "unexpected-request"
+)
+
+func (c StanzaCondition) Error() string {
+	return string(c)
+}
+
+// Stanza error types (RFC 6120 8.3.2)
+const (
+	ErrorAuth     = "auth"
+	ErrorCancel   = "cancel"
+	ErrorContinue = "continue"
+	ErrorModify   = "modify"
+	ErrorWait     = "wait"
+)
+
+// Type returns the error type recommended for the condition.
+func (c StanzaCondition) Type() string {
+	switch c {
+	case StanzaBadRequest, StanzaJidMalformed, StanzaNotAcceptable,
+		StanzaPolicyViolation, StanzaRedirect:
+		return ErrorModify
+	case StanzaForbidden, StanzaNotAuthorized, StanzaRegistrationRequired,
+		StanzaSubscriptionRequired:
+		return ErrorAuth
+	case StanzaRecipientUnavailable, StanzaRemoteServerTimeout,
+		StanzaResourceConstraint, StanzaUnexpectedRequest:
+		return ErrorWait
+	}
+	return ErrorCancel
+}
+
+// AppCondition is an application-specific condition of an error, kept as is.
+type AppCondition struct {
+	XMLName  xml.Name
+	Attr     []xml.Attr `xml:",any,attr"`
+	InnerXML string     `xml:",innerxml"`
+}
+
+func (e AppCondition) Name() string {
+	return e.XMLName.Local
+}
+
+func (e AppCondition) FullName() string {
+	return e.XMLName.Space + " " + e.XMLName.Local
+}
+
+// errorChildren are the children of a stream or a stanza error, in the ns namespace.
+type errorChildren struct {
+	Condition xml.Name
+	Data      string // the content of the condition, like the host of see-other-host
+	Text      string
+	Lang      string
+	App       *AppCondition
+}
+
+// decode reads the children until the end of the error.
+func (c *errorChildren) decode(d *xml.Decoder, ns string) error {
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Space != ns {
+				app := &AppCondition{}
+				if err := d.DecodeElement(app, &t); err != nil {
+					return err
+				}
+				if c.App == nil {
+					c.App = app
+				}
+				// the namespace declarations are written again from XMLName.
+				attrs := app.Attr[:0]
+				for _, a := range app.Attr {
+					if a.Name.Space != "xmlns" && a.Name.Local != "xmlns" {
+						attrs = append(attrs, a)
+					}
+				}
+				app.Attr = attrs
+				continue
+			}
+
+			var v struct {
+				Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+				Data string `xml:",chardata"`
+			}
+			if err := d.DecodeElement(&v, &t); err != nil {
+				return err
+			}
+			switch {
+			case t.Name.Local == "text":
+				c.Text, c.Lang = v.Data, v.Lang
+			case c.Condition.Local == "":
+				c.Condition = t.Name
+				c.Data = strings.TrimSpace(v.Data)
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+func (c *errorChildren) encode(e *xml.Encoder, ns string) error {
+	name := c.Condition.Local
+	if name == "" {
+		name = "undefined-condition"
+	}
+	if err := e.EncodeElement(c.Data, xml.StartElement{Name: xml.Name{Space: ns, Local: name}}); err != nil {
+		return err
+	}
+
+	if c.Text != "" {
+		text := xml.StartElement{Name: xml.Name{Space: ns, Local: "text"}}
+		if c.Lang != "" {
+			text.Attr = []xml.Attr{{Name: xml.Name{Space: nsXML, Local: "lang"}, Value: c.Lang}}
+		}
+		if err := e.EncodeElement(c.Text, text); err != nil {
+			return err
+		}
+	}
+
+	if c.App != nil {
+		return e.Encode(c.App)
+	}
+	return nil
+}
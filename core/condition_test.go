@@ -0,0 +1,132 @@
+// condition test
+package core
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStanzaError(t *testing.T) {
+	const data = "<error xmlns='jabber:client' type='cancel' by='example.net'>" +
+		"<redirect xmlns='urn:ietf:params:xml:ns:xmpp-stanzas'> xmpp:characters@conference.example.org </redirect>" +
+		"<text xmlns='urn:ietf:params:xml:ns:xmpp-stanzas' xml:lang='en'>moved</text>" +
+		"<too-many-stanzas xmlns='urn:example:app' limit='10'><count>11</count></too-many-stanzas>" +
+		"</error>"
+	e := &StanzaError{}
+	if err := xml.Unmarshal([]byte(data), e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Condition() != StanzaRedirect || e.Type != ErrorCancel || e.By != "example.net" ||
+		e.URI != "xmpp:characters@conference.example.org" || e.Text != "moved" || e.Lang != "en" {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if e.App == nil || e.App.FullName() != "urn:example:app too-many-stanzas" ||
+		len(e.App.Attr) != 1 || e.App.Attr[0].Value != "10" || e.App.InnerXML != "<count>11</count>" {
+		t.Errorf("unexpected application condition %+v", e.App)
+	}
+	if got, want := e.Error(), "redirect: moved"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	// the sentinels match the wrapped errors of their condition only.
+	err := fmt.Errorf("send: %w", e)
+	if !errors.Is(err, StanzaRedirect) {
+		t.Error("the error is not a StanzaRedirect")
+	}
+	if errors.Is(err, StanzaGone) || errors.Is(err, StreamSeeOtherHost) {
+		t.Error("the error matches another condition")
+	}
+	var se *StanzaError
+	if !errors.As(err, &se) || se != e {
+		t.Error("errors.As did not find the stanza error")
+	}
+
+	// encoded again, it decodes to the same error.
+	out, err := xml.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e2 := &StanzaError{}
+	if err := xml.Unmarshal(out, e2); err != nil {
+		t.Fatalf("%s: %v", out, err)
+	}
+	if e2.Condition() != e.Condition() || e2.Type != e.Type || e2.By != e.By || e2.URI != e.URI ||
+		e2.Text != e.Text || e2.Lang != e.Lang || e2.App == nil || e2.App.FullName() != e.App.FullName() ||
+		e2.App.InnerXML != e.App.InnerXML {
+		t.Errorf("%s: decoded to %+v, want %+v", out, e2, e)
+	}
+}
+
+func TestNewStanzaError(t *testing.T) {
+	for _, tt := range []struct {
+		cond StanzaCondition
+		typ  string
+	}{
+		{StanzaBadRequest, ErrorModify},
+		{StanzaNotAuthorized, ErrorAuth},
+		{StanzaResourceConstraint, ErrorWait},
+		{StanzaServiceUnavailable, ErrorCancel},
+		{StanzaFeatureNotImplemented, ErrorCancel},
+	} {
+		e := NewStanzaError(tt.cond, "")
+		if e.Type != tt.typ || !errors.Is(e, tt.cond) {
+			t.Errorf("NewStanzaError(%s) = %+v, want the type %s", tt.cond, e, tt.typ)
+		}
+		out, err := xml.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "<error xmlns=\"jabber:client\" type=\"" + tt.typ + "\"><" + string(tt.cond) +
+			" xmlns=\"urn:ietf:params:xml:ns:xmpp-stanzas\"></" + string(tt.cond) + "></error>"
+		if string(out) != want {
+			t.Errorf("got %s, want %s", out, want)
+		}
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	const data = "<stream:error xmlns:stream='http://etherx.jabber.org/streams'>" +
+		"<see-other-host xmlns='urn:ietf:params:xml:ns:xmpp-streams'>[2001:db8::1]:5222</see-other-host>" +
+		"<text xmlns='urn:ietf:params:xml:ns:xmpp-streams' xml:lang='en'>moved</text>" +
+		"</stream:error>"
+	e := &StreamError{}
+	if err := xml.Unmarshal([]byte(data), e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Condition() != StreamSeeOtherHost || e.SeeOtherHost != "[2001:db8::1]:5222" ||
+		e.Text != "moved" || e.Lang != "en" || e.App != nil {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if got, want := e.Error(), "see-other-host: moved"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	err := fmt.Errorf("login: %w", e)
+	if !errors.Is(err, StreamSeeOtherHost) || errors.Is(err, StreamHostGone) || errors.Is(err, StanzaRedirect) {
+		t.Error("the error does not match its condition only")
+	}
+
+	// the host is only kept with see-other-host.
+	e = &StreamError{}
+	if err := xml.Unmarshal([]byte("<stream:error xmlns:stream='http://etherx.jabber.org/streams'>"+
+		"<host-unknown xmlns='urn:ietf:params:xml:ns:xmpp-streams'>example.org</host-unknown>"+
+		"</stream:error>"), e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Condition() != StreamHostUnknown || e.SeeOtherHost != "" {
+		t.Errorf("unexpected error %+v", e)
+	}
+
+	out, err := xml.Marshal(NewStreamError(StreamSeeOtherHost, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = &StreamError{}
+	if err := xml.Unmarshal(out, e); err != nil {
+		t.Fatalf("%s: %v", out, err)
+	}
+	if !errors.Is(e, StreamSeeOtherHost) {
+		t.Errorf("%s: decoded to %+v", out, e)
+	}
+}
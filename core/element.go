@@ -26,6 +26,57 @@ type StreamError struct {
 	XMLName xml.Name `xml:"http://etherx.jabber.org/streams error"`
 	Err     xml.Name `xml:",any"`
 	Text    string   `xml:"text"`
+	Lang    string   `xml:"-"` // of Text
+	// SeeOtherHost is the "host" or "host:port" to connect to instead,
+	// with the see-other-host condition.
+	SeeOtherHost string `xml:"-"`
+	// App is the application-specific condition, if any.
+	App *AppCondition `xml:"-"`
+}
+
+// NewStreamError returns the stream error of the condition.
+func NewStreamError(cond StreamCondition, text string) *StreamError {
+	return &StreamError{
+		XMLName: xml.Name{Space: "http://etherx.jabber.org/streams", Local: "error"},
+		Err:     xml.Name{Space: nsStreams, Local: string(cond)},
+		Text:    text,
+	}
+}
+
+// Condition returns the defined condition of the error.
+func (e *StreamError) Condition() StreamCondition {
+	return StreamCondition(e.Err.Local)
+}
+
+// Is reports whether the error has the condition target, see StreamCondition.
+func (e *StreamError) Is(target error) bool {
+	cond, ok := target.(StreamCondition)
+	return ok && cond == e.Condition()
+}
+
+func (e *StreamError) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	e.XMLName = start.Name
+	c := &errorChildren{}
+	if err := c.decode(d, nsStreams); err != nil {
+		return err
+	}
+	e.Err, e.Text, e.Lang, e.App = c.Condition, c.Text, c.Lang, c.App
+	if e.Condition() == StreamSeeOtherHost {
+		e.SeeOtherHost = c.Data
+	}
+	return nil
+}
+
+func (e StreamError) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Space: "http://etherx.jabber.org/streams", Local: "error"}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	c := &errorChildren{Condition: e.Err, Data: e.SeeOtherHost, Text: e.Text, Lang: e.Lang, App: e.App}
+	if err := c.encode(enc, nsStreams); err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
 }
 
 func (_ StreamError) Name() string {
@@ -36,5 +87,8 @@ func (_ StreamError) FullName() string {
 	return "http://etherx.jabber.org/streams error"
 }
 func (e *StreamError) Error() string {
+	if e.Text == "" {
+		return e.Err.Local
+	}
 	return e.Err.Local + ": " + e.Text
 }
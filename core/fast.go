@@ -0,0 +1,52 @@
+// XEP-0484: Fast Authentication Streamlining Tokens
+// http://xmpp.org/extensions/xep-0484.html
+package core
+
+import (
+	"encoding/xml"
+)
+
+// Fast is both the FAST feature inlined in the SASL2 <authentication/> feature,
+// and the element telling the server that a token is used to authenticate.
+type Fast struct {
+	XMLName    xml.Name `xml:"urn:xmpp:fast:0 fast"`
+	Tls0Rtt    bool     `xml:"tls-0rtt,attr,omitempty"`
+	Count      int      `xml:"count,attr,omitempty"`
+	Invalidate bool     `xml:"invalidate,attr,omitempty"`
+	Mechanism  []string `xml:"mechanism"`
+}
+
+func (_ Fast) Name() string {
+	return "fast"
+}
+
+func (_ Fast) FullName() string {
+	return "urn:xmpp:fast:0 fast"
+}
+
+type FastRequestToken struct {
+	XMLName   xml.Name `xml:"urn:xmpp:fast:0 request-token"`
+	Mechanism string   `xml:"mechanism,attr"`
+}
+
+func (_ FastRequestToken) Name() string {
+	return "request-token"
+}
+
+func (_ FastRequestToken) FullName() string {
+	return "urn:xmpp:fast:0 request-token"
+}
+
+type FastToken struct {
+	XMLName xml.Name `xml:"urn:xmpp:fast:0 token"`
+	Expiry  string   `xml:"expiry,attr"`
+	Token   string   `xml:"token,attr"`
+}
+
+func (_ FastToken) Name() string {
+	return "token"
+}
+
+func (_ FastToken) FullName() string {
+	return "urn:xmpp:fast:0 token"
+}
@@ -8,11 +8,14 @@ import (
 type StreamFeatures struct {
 	XMLName xml.Name `xml:"http://etherx.jabber.org/streams features"`
 
-	StartTLS   *TlsStartTLS
-	Mechanisms *SaslMechanisms
-	Compress   *FeatureCompress
-	Bind       *FeatureBind
-	Session    *FeatureSession
+	StartTLS       *TlsStartTLS
+	Mechanisms     *SaslMechanisms
+	ChannelBinding *SaslChannelBinding
+	Authentication *Sasl2Authentication
+	Compress       *FeatureCompress
+	Bind           *FeatureBind
+	Session        *FeatureSession
+	Sm             *SmFeature
 }
 
 func (_ StreamFeatures) Name() string {
@@ -0,0 +1,47 @@
+// RFC 7395: An XMPP Subprotocol for WebSocket
+// https://tools.ietf.org/html/rfc7395
+package core
+
+import (
+	"encoding/xml"
+)
+
+// FramingOpen opens the stream, in place of <stream:stream>.
+type FramingOpen struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:xmpp-framing open"`
+	Id      string   `xml:"id,attr,omitempty"`
+	From    string   `xml:"from,attr,omitempty"`
+	To      string   `xml:"to,attr,omitempty"`
+	Version string   `xml:"version,attr"`
+	Lang    string   `xml:"http://www.w3.org/XML/1998/namespace lang,attr,omitempty"`
+}
+
+func (_ FramingOpen) Name() string {
+	return "open"
+}
+
+func (_ FramingOpen) FullName() string {
+	return "urn:ietf:params:xml:ns:xmpp-framing open"
+}
+
+// FramingClose closes the stream, in place of </stream:stream>.
+// SeeOtherUri redirects the client to another WebSocket endpoint.
+type FramingClose struct {
+	XMLName     xml.Name `xml:"urn:ietf:params:xml:ns:xmpp-framing close"`
+	SeeOtherUri string   `xml:"see-other-uri,attr,omitempty"`
+}
+
+func (_ FramingClose) Name() string {
+	return "close"
+}
+
+func (_ FramingClose) FullName() string {
+	return "urn:ietf:params:xml:ns:xmpp-framing close"
+}
+
+func (e FramingClose) Error() string {
+	if e.SeeOtherUri != "" {
+		return "stream closed, see other uri " + e.SeeOtherUri
+	}
+	return "stream closed"
+}
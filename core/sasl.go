@@ -105,3 +105,21 @@ func (_ SaslMechanisms) Name() string {
 func (_ SaslMechanisms) FullName() string {
 	return "urn:ietf:params:xml:ns:xmpp-sasl mechanisms"
 }
+
+// XEP-0440: SASL Channel-Binding Type Capability
+type SaslChannelBinding struct {
+	XMLName xml.Name              `xml:"urn:xmpp:sasl-cb:0 sasl-channel-binding"`
+	Types   []*ChannelBindingType `xml:"channel-binding"`
+}
+
+func (_ SaslChannelBinding) Name() string {
+	return "sasl-channel-binding"
+}
+
+func (_ SaslChannelBinding) FullName() string {
+	return "urn:xmpp:sasl-cb:0 sasl-channel-binding"
+}
+
+type ChannelBindingType struct {
+	Type string `xml:"type,attr"`
+}
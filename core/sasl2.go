@@ -0,0 +1,176 @@
+// XEP-0388: Extensible SASL Profile
+// http://xmpp.org/extensions/xep-0388.html
+// XEP-0386: Bind 2
+// http://xmpp.org/extensions/xep-0386.html
+package core
+
+import (
+	"encoding/xml"
+)
+
+type Sasl2Authentication struct {
+	XMLName   xml.Name     `xml:"urn:xmpp:sasl:2 authentication"`
+	Mechanism []string     `xml:"mechanism"`
+	Inline    *Sasl2Inline `xml:"inline"`
+}
+
+func (_ Sasl2Authentication) Name() string {
+	return "authentication"
+}
+
+func (_ Sasl2Authentication) FullName() string {
+	return "urn:xmpp:sasl:2 authentication"
+}
+
+// Sasl2Inline lists the features that can be negotiated along with the authentication.
+type Sasl2Inline struct {
+	Bind *Bind2Feature
+	Fast *Fast
+	Sm   *SmFeature
+}
+
+type Sasl2Authenticate struct {
+	XMLName         xml.Name   `xml:"urn:xmpp:sasl:2 authenticate"`
+	Mechanism       string     `xml:"mechanism,attr"`
+	InitialResponse string     `xml:"initial-response,omitempty"`
+	UserAgent       *UserAgent `xml:"user-agent"`
+	Bind            *Bind2
+	RequestToken    *FastRequestToken
+	Fast            *Fast
+	Resume          *SmResume
+}
+
+func (_ Sasl2Authenticate) Name() string {
+	return "authenticate"
+}
+
+func (_ Sasl2Authenticate) FullName() string {
+	return "urn:xmpp:sasl:2 authenticate"
+}
+
+type UserAgent struct {
+	Id       string `xml:"id,attr,omitempty"`
+	Software string `xml:"software,omitempty"`
+	Device   string `xml:"device,omitempty"`
+}
+
+type Sasl2Challenge struct {
+	XMLName xml.Name `xml:"urn:xmpp:sasl:2 challenge"`
+	Value   string   `xml:",chardata"`
+}
+
+func (_ Sasl2Challenge) Name() string {
+	return "challenge"
+}
+
+func (_ Sasl2Challenge) FullName() string {
+	return "urn:xmpp:sasl:2 challenge"
+}
+
+type Sasl2Response struct {
+	XMLName xml.Name `xml:"urn:xmpp:sasl:2 response"`
+	Value   string   `xml:",chardata"`
+}
+
+func (_ Sasl2Response) Name() string {
+	return "response"
+}
+
+func (_ Sasl2Response) FullName() string {
+	return "urn:xmpp:sasl:2 response"
+}
+
+type Sasl2Success struct {
+	XMLName                 xml.Name    `xml:"urn:xmpp:sasl:2 success"`
+	AdditionalData          string      `xml:"additional-data,omitempty"`
+	AuthorizationIdentifier string      `xml:"authorization-identifier"`
+	Bound                   *Bind2Bound `xml:"urn:xmpp:bind:0 bound"`
+	Token                   *FastToken
+	Resumed                 *SmResumed
+	Failed                  *SmFailed
+}
+
+func (_ Sasl2Success) Name() string {
+	return "success"
+}
+
+func (_ Sasl2Success) FullName() string {
+	return "urn:xmpp:sasl:2 success"
+}
+
+type Sasl2Failure struct {
+	XMLName xml.Name `xml:"urn:xmpp:sasl:2 failure"`
+	Reason  xml.Name `xml:",any"`
+	Text    string   `xml:"text"`
+}
+
+func (_ Sasl2Failure) Name() string {
+	return "failure"
+}
+
+func (_ Sasl2Failure) FullName() string {
+	return "urn:xmpp:sasl:2 failure"
+}
+
+func (e Sasl2Failure) Error() string {
+	return e.Reason.Local + ": " + e.Text
+}
+
+type Sasl2Continue struct {
+	XMLName        xml.Name `xml:"urn:xmpp:sasl:2 continue"`
+	AdditionalData string   `xml:"additional-data,omitempty"`
+	Tasks          []string `xml:"tasks>task"`
+	Text           string   `xml:"text,omitempty"`
+}
+
+func (_ Sasl2Continue) Name() string {
+	return "continue"
+}
+
+func (_ Sasl2Continue) FullName() string {
+	return "urn:xmpp:sasl:2 continue"
+}
+
+type Sasl2Abort struct {
+	XMLName xml.Name `xml:"urn:xmpp:sasl:2 abort"`
+	Text    string   `xml:"text,omitempty"`
+}
+
+func (_ Sasl2Abort) Name() string {
+	return "abort"
+}
+
+func (_ Sasl2Abort) FullName() string {
+	return "urn:xmpp:sasl:2 abort"
+}
+
+// Bind2Feature is the Bind 2 feature inlined in the SASL2 <authentication/> feature.
+type Bind2Feature struct {
+	XMLName  xml.Name       `xml:"urn:xmpp:bind:0 bind"`
+	Features []*Bind2Inline `xml:"inline>feature"`
+}
+
+type Bind2Inline struct {
+	Var string `xml:"var,attr"`
+}
+
+// Bind2 is the request to bind a resource along with the SASL2 authentication.
+type Bind2 struct {
+	XMLName xml.Name `xml:"urn:xmpp:bind:0 bind"`
+	Tag     string   `xml:"tag,omitempty"`
+	Enable  *SmEnable
+}
+
+func (_ Bind2) Name() string {
+	return "bind"
+}
+
+func (_ Bind2) FullName() string {
+	return "urn:xmpp:bind:0 bind"
+}
+
+type Bind2Bound struct {
+	XMLName xml.Name `xml:"urn:xmpp:bind:0 bound"`
+	Enabled *SmEnabled
+	Failed  *SmFailed
+}
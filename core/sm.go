@@ -0,0 +1,120 @@
+// XEP-0198: Stream Management
+// http://xmpp.org/extensions/xep-0198.html
+package core
+
+import (
+	"encoding/xml"
+)
+
+type SmFeature struct {
+	XMLName xml.Name `xml:"urn:xmpp:sm:3 sm"`
+}
+
+func (_ SmFeature) Name() string {
+	return "sm"
+}
+
+func (_ SmFeature) FullName() string {
+	return "urn:xmpp:sm:3 sm"
+}
+
+type SmEnable struct {
+	XMLName xml.Name `xml:"urn:xmpp:sm:3 enable"`
+	Resume  bool     `xml:"resume,attr,omitempty"`
+	Max     int      `xml:"max,attr,omitempty"`
+}
+
+func (_ SmEnable) Name() string {
+	return "enable"
+}
+
+func (_ SmEnable) FullName() string {
+	return "urn:xmpp:sm:3 enable"
+}
+
+type SmEnabled struct {
+	XMLName  xml.Name `xml:"urn:xmpp:sm:3 enabled"`
+	Id       string   `xml:"id,attr,omitempty"`
+	Resume   bool     `xml:"resume,attr,omitempty"`
+	Max      int      `xml:"max,attr,omitempty"`
+	Location string   `xml:"location,attr,omitempty"`
+}
+
+func (_ SmEnabled) Name() string {
+	return "enabled"
+}
+
+func (_ SmEnabled) FullName() string {
+	return "urn:xmpp:sm:3 enabled"
+}
+
+type SmResume struct {
+	XMLName xml.Name `xml:"urn:xmpp:sm:3 resume"`
+	H       uint32   `xml:"h,attr"`
+	Previd  string   `xml:"previd,attr"`
+}
+
+func (_ SmResume) Name() string {
+	return "resume"
+}
+
+func (_ SmResume) FullName() string {
+	return "urn:xmpp:sm:3 resume"
+}
+
+type SmResumed struct {
+	XMLName xml.Name `xml:"urn:xmpp:sm:3 resumed"`
+	H       uint32   `xml:"h,attr"`
+	Previd  string   `xml:"previd,attr"`
+}
+
+func (_ SmResumed) Name() string {
+	return "resumed"
+}
+
+func (_ SmResumed) FullName() string {
+	return "urn:xmpp:sm:3 resumed"
+}
+
+type SmFailed struct {
+	XMLName   xml.Name `xml:"urn:xmpp:sm:3 failed"`
+	H         *uint32  `xml:"h,attr,omitempty"`
+	Condition xml.Name `xml:",any"`
+}
+
+func (_ SmFailed) Name() string {
+	return "failed"
+}
+
+func (_ SmFailed) FullName() string {
+	return "urn:xmpp:sm:3 failed"
+}
+
+func (e SmFailed) Error() string {
+	return "stream management failed: " + e.Condition.Local
+}
+
+type SmRequest struct {
+	XMLName xml.Name `xml:"urn:xmpp:sm:3 r"`
+}
+
+func (_ SmRequest) Name() string {
+	return "r"
+}
+
+func (_ SmRequest) FullName() string {
+	return "urn:xmpp:sm:3 r"
+}
+
+type SmAck struct {
+	XMLName xml.Name `xml:"urn:xmpp:sm:3 a"`
+	H       uint32   `xml:"h,attr"`
+}
+
+func (_ SmAck) Name() string {
+	return "a"
+}
+
+func (_ SmAck) FullName() string {
+	return "urn:xmpp:sm:3 a"
+}
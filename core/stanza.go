@@ -19,8 +19,26 @@ type StanzaError struct {
 	XMLName xml.Name `xml:"jabber:client error"`
 	Code    string   `xml:"code,attr"`
 	Type    string   `xml:"type,attr"`
-	Reason  xml.Name `xml:",any"`
-	Text    string   `xml:"text,omitempty"`
+	// By is the entity that generated the error, if not the recipient of the stanza.
+	By     string   `xml:"by,attr"`
+	Reason xml.Name `xml:",any"`
+	Text   string   `xml:"text,omitempty"`
+	Lang   string   `xml:"-"` // of Text
+	// URI is the new address of the entity, with the gone and redirect conditions.
+	URI string `xml:"-"`
+	// App is the application-specific condition, if any.
+	App *AppCondition `xml:"-"`
+}
+
+// NewStanzaError returns the stanza error of the condition, with the type
+// recommended for it.
+func NewStanzaError(cond StanzaCondition, text string) *StanzaError {
+	return &StanzaError{
+		XMLName: xml.Name{Space: "jabber:client", Local: "error"},
+		Type:    cond.Type(),
+		Reason:  xml.Name{Space: nsStanzas, Local: string(cond)},
+		Text:    text,
+	}
 }
 
 func (_ StanzaError) Name() string {
@@ -31,8 +49,72 @@ func (_ StanzaError) FullName() string {
 	return "jabber:client error"
 }
 
+// Condition returns the defined condition of the error.
+func (e *StanzaError) Condition() StanzaCondition {
+	return StanzaCondition(e.Reason.Local)
+}
+
+// Is reports whether the error has the condition target, see StanzaCondition.
+func (e *StanzaError) Is(target error) bool {
+	cond, ok := target.(StanzaCondition)
+	return ok && cond == e.Condition()
+}
+
 func (e *StanzaError) Error() string {
-	return e.Code + ": " + e.Reason.Local
+	s := e.Reason.Local
+	if s == "" {
+		s = "error " + e.Code
+	}
+	if e.Text != "" {
+		s += ": " + e.Text
+	}
+	return s
+}
+
+func (e *StanzaError) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	e.XMLName = start.Name
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "code":
+			e.Code = attr.Value
+		case "type":
+			e.Type = attr.Value
+		case "by":
+			e.By = attr.Value
+		}
+	}
+
+	c := &errorChildren{}
+	if err := c.decode(d, nsStanzas); err != nil {
+		return err
+	}
+	e.Reason, e.Text, e.Lang, e.App = c.Condition, c.Text, c.Lang, c.App
+	switch e.Condition() {
+	case StanzaGone, StanzaRedirect:
+		e.URI = c.Data
+	}
+	return nil
+}
+
+func (e StanzaError) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Space: "jabber:client", Local: "error"}}
+	for _, attr := range []xml.Attr{
+		{Name: xml.Name{Local: "type"}, Value: e.Type},
+		{Name: xml.Name{Local: "by"}, Value: e.By},
+		{Name: xml.Name{Local: "code"}, Value: e.Code},
+	} {
+		if attr.Value != "" {
+			start.Attr = append(start.Attr, attr)
+		}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	c := &errorChildren{Condition: e.Reason, Data: e.URI, Text: e.Text, Lang: e.Lang, App: e.App}
+	if err := c.encode(enc, nsStanzas); err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
 }
 
 type RosterQuery struct {
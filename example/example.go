@@ -18,11 +18,13 @@ import (
 	"net"
 )
 
-var server = flag.String("server", "talk.google.com:443", "server")
+var server = flag.String("server", "talk.google.com:5222", "server, use -directtls for a direct TLS port like 443")
 var proxy = flag.String("proxy", "", "proxy server")
 var username = flag.String("username", "", "username")
 var password = flag.String("password", "", "password")
+var token = flag.String("token", "", "OAuth 2.0 access token")
 var notls = flag.Bool("notls", false, "No TLS")
+var directtls = flag.Bool("directtls", false, "Direct TLS instead of STARTTLS")
 var debug = flag.Bool("debug", false, "debug output")
 
 var features []string
@@ -36,12 +38,25 @@ func main() {
 		os.Exit(2)
 	}
 	flag.Parse()
-	if *username == "" || *password == "" {
+	if *username == "" || (*password == "" && *token == "") {
 		flag.Usage()
 	}
 
+	security := client.SecurityStartTLS
+	if *directtls {
+		security = client.SecurityDirectTLS
+	}
+	if *notls {
+		security = client.SecurityNone
+	}
+
 	talk := client.NewClient(*server, *username, *password,
-		&client.Options{Proxy: *proxy, NoTLS: *notls, Debug: *debug, TlsConfig: &tls.Config{InsecureSkipVerify: true}})
+		&client.Options{Proxy: *proxy, Security: security, Debug: *debug, TlsConfig: &tls.Config{InsecureSkipVerify: true}})
+	if *token != "" {
+		talk.TokenSource = func() (string, error) {
+			return *token, nil
+		}
+	}
 
 	talk.HandleFunc(xmpp.NSClient+" message", func(header *core.StanzaHeader, e xmpp.Element) {
 		log.Println(e)
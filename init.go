@@ -16,6 +16,12 @@ func init() {
 		func() Element { return new(core.StreamFeatures) })
 	Register("http://jabber.org/features/compress compression",
 		func() Element { return new(core.FeatureCompress) })
+	Register("http://jabber.org/protocol/compress compress",
+		func() Element { return new(core.Compress) })
+	Register("http://jabber.org/protocol/compress compressed",
+		func() Element { return new(core.Compressed) })
+	Register("http://jabber.org/protocol/compress failure",
+		func() Element { return new(core.CompressFailure) })
 	Register("urn:ietf:params:xml:ns:xmpp-bind bind",
 		func() Element { return new(core.FeatureBind) })
 	Register("urn:ietf:params:xml:ns:xmpp-session session",
@@ -40,6 +46,10 @@ func init() {
 		func() Element { return new(core.TlsFailure) })
 	Register("urn:ietf:params:xml:ns:xmpp-tls proceed",
 		func() Element { return new(core.TlsProceed) })
+	Register("urn:ietf:params:xml:ns:xmpp-framing open",
+		func() Element { return new(core.FramingOpen) })
+	Register("urn:ietf:params:xml:ns:xmpp-framing close",
+		func() Element { return new(core.FramingClose) })
 	Register("jabber:client iq",
 		func() Element { return NewStanza("iq") })
 	Register("jabber:client message",
@@ -107,10 +117,59 @@ func init() {
 	// XEP166
 	Register("urn:xmpp:jingle:1 jingle",
 		func() Element { return new(xep.Jingle) })
+	// XEP198
+	Register("urn:xmpp:sm:3 sm",
+		func() Element { return new(core.SmFeature) })
+	Register("urn:xmpp:sm:3 enable",
+		func() Element { return new(core.SmEnable) })
+	Register("urn:xmpp:sm:3 enabled",
+		func() Element { return new(core.SmEnabled) })
+	Register("urn:xmpp:sm:3 resume",
+		func() Element { return new(core.SmResume) })
+	Register("urn:xmpp:sm:3 resumed",
+		func() Element { return new(core.SmResumed) })
+	Register("urn:xmpp:sm:3 failed",
+		func() Element { return new(core.SmFailed) })
+	Register("urn:xmpp:sm:3 r",
+		func() Element { return new(core.SmRequest) })
+	Register("urn:xmpp:sm:3 a",
+		func() Element { return new(core.SmAck) })
 	// XEP199
 	Register("urn:xmpp:ping ping",
 		func() Element { return new(xep.Ping) })
 	// XEP203
 	Register("urn:xmpp:delay delay",
 		func() Element { return new(xep.Delay) })
+	// XEP359
+	Register("urn:xmpp:sid:0 stanza-id",
+		func() Element { return new(xep.StanzaID) })
+	Register("urn:xmpp:sid:0 origin-id",
+		func() Element { return new(xep.OriginID) })
+	// XEP388
+	Register("urn:xmpp:sasl:2 authentication",
+		func() Element { return new(core.Sasl2Authentication) })
+	Register("urn:xmpp:sasl:2 authenticate",
+		func() Element { return new(core.Sasl2Authenticate) })
+	Register("urn:xmpp:sasl:2 challenge",
+		func() Element { return new(core.Sasl2Challenge) })
+	Register("urn:xmpp:sasl:2 response",
+		func() Element { return new(core.Sasl2Response) })
+	Register("urn:xmpp:sasl:2 success",
+		func() Element { return new(core.Sasl2Success) })
+	Register("urn:xmpp:sasl:2 failure",
+		func() Element { return new(core.Sasl2Failure) })
+	Register("urn:xmpp:sasl:2 continue",
+		func() Element { return new(core.Sasl2Continue) })
+	Register("urn:xmpp:sasl:2 abort",
+		func() Element { return new(core.Sasl2Abort) })
+	// XEP440
+	Register("urn:xmpp:sasl-cb:0 sasl-channel-binding",
+		func() Element { return new(core.SaslChannelBinding) })
+	// XEP484
+	Register("urn:xmpp:fast:0 fast",
+		func() Element { return new(core.Fast) })
+	Register("urn:xmpp:fast:0 request-token",
+		func() Element { return new(core.FastRequestToken) })
+	Register("urn:xmpp:fast:0 token",
+		func() Element { return new(core.FastToken) })
 }
@@ -0,0 +1,320 @@
+// jid
+package xmpp
+
+import (
+	"errors"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/secure/precis"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxPartLen is the maximum length in bytes of each part of a JID (RFC 7622 3).
+const maxPartLen = 1023
+
+// JID is an XMPP address, localpart@domainpart/resourcepart (RFC 7622).
+// The parts are normalized when parsed: the localpart with the PRECIS
+// UsernameCaseMapped profile, the resourcepart with OpaqueString and the domainpart
+// with IDNA2008, so that equal addresses compare equal.
+type JID struct {
+	local    string
+	domain   string
+	resource string
+}
+
+// JIDError reports an invalid part of a JID.
+type JIDError struct {
+	JID  string
+	Part string // "localpart", "domainpart" or "resourcepart"
+	Err  error
+}
+
+func (e *JIDError) Error() string {
+	return "xmpp: invalid " + e.Part + " in JID " + strconv.Quote(e.JID) + ": " + e.Err.Error()
+}
+
+func (e *JIDError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	errEmptyPart   = errors.New("empty")
+	errPartTooLong = errors.New("longer than 1023 bytes")
+)
+
+// Parse parses and normalizes a JID.
+func Parse(s string) (JID, error) {
+	switch {
+	case strings.HasPrefix(s, "@"):
+		return JID{}, &JIDError{JID: s, Part: "localpart", Err: errEmptyPart}
+	case strings.IndexByte(s, '/') == len(s)-1 && s != "":
+		return JID{}, &JIDError{JID: s, Part: "resourcepart", Err: errEmptyPart}
+	}
+	local, domain, resource := splitJID(s)
+	return newJID(s, local, domain, resource)
+}
+
+// MustParse is like Parse but panics if s is not a valid JID.
+func MustParse(s string) JID {
+	jid, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return jid
+}
+
+// NewJID returns the JID of the parts, normalized. The localpart and the
+// resourcepart are optional.
+func NewJID(local, domain, resource string) (JID, error) {
+	return newJID(joinJID(local, domain, resource), local, domain, resource)
+}
+
+func newJID(s, local, domain, resource string) (JID, error) {
+	var err error
+	if local, err = prepLocal(local); err != nil {
+		return JID{}, &JIDError{JID: s, Part: "localpart", Err: err}
+	}
+	if domain, err = prepDomain(domain); err != nil {
+		return JID{}, &JIDError{JID: s, Part: "domainpart", Err: err}
+	}
+	if resource, err = prepResource(resource); err != nil {
+		return JID{}, &JIDError{JID: s, Part: "resourcepart", Err: err}
+	}
+	return JID{local: local, domain: domain, resource: resource}, nil
+}
+
+// ToJID returns the JID of s, normalized if valid, as is otherwise.
+// Use Parse to validate a JID.
+func ToJID(s string) JID {
+	if jid, err := Parse(s); err == nil {
+		return jid
+	}
+	local, domain, resource := splitJID(s)
+	return JID{local: local, domain: domain, resource: resource}
+}
+
+// splitJID splits s at the first '/', then the first '@' before it (RFC 7622 3.1).
+func splitJID(s string) (local, domain, resource string) {
+	domain, resource, _ = strings.Cut(s, "/")
+	if l, d, ok := strings.Cut(domain, "@"); ok {
+		local, domain = l, d
+	}
+	return
+}
+
+func joinJID(local, domain, resource string) string {
+	s := domain
+	if local != "" {
+		s = local + "@" + s
+	}
+	if resource != "" {
+		s += "/" + resource
+	}
+	return s
+}
+
+func checkLen(s string) error {
+	switch {
+	case s == "":
+		return errEmptyPart
+	case len(s) > maxPartLen:
+		return errPartTooLong
+	}
+	return nil
+}
+
+// prepLocal enforces the UsernameCaseMapped profile, without the characters
+// forbidden in a localpart (RFC 7622 3.3.1).
+func prepLocal(local string) (string, error) {
+	if local == "" {
+		return "", nil
+	}
+	local, err := precis.UsernameCaseMapped.String(local)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(local, "\"&'/:<>@") {
+		return "", errors.New("forbidden character in " + strconv.Quote(local))
+	}
+	return local, checkLen(local)
+}
+
+// prepDomain converts the A-labels to U-labels and lower cases the domain
+// (RFC 7622 3.2). IP addresses are kept as is.
+func prepDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(domain, ".")
+	if err := checkLen(domain); err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		if ip := net.ParseIP(domain[1 : len(domain)-1]); ip == nil || ip.To4() != nil {
+			return "", errors.New("invalid IPv6 address " + domain)
+		}
+		return domain, nil
+	}
+	if net.ParseIP(domain) != nil {
+		return domain, nil
+	}
+
+	domain, err := idna.Lookup.ToUnicode(domain)
+	if err != nil {
+		return "", err
+	}
+	return domain, checkLen(domain)
+}
+
+// prepResource enforces the OpaqueString profile (RFC 7622 3.4).
+func prepResource(resource string) (string, error) {
+	if resource == "" {
+		return "", nil
+	}
+	resource, err := precis.OpaqueString.String(resource)
+	if err != nil {
+		return "", err
+	}
+	return resource, checkLen(resource)
+}
+
+// XEP-0106: JID Escaping
+var escapes = map[byte]string{
+	' ':  `\20`,
+	'"':  `\22`,
+	'&':  `\26`,
+	'\'': `\27`,
+	'/':  `\2f`,
+	':':  `\3a`,
+	'<':  `\3c`,
+	'>':  `\3e`,
+	'@':  `\40`,
+	'\\': `\5c`,
+}
+
+// unescapes maps the escape sequences, without the backslash, to their character.
+var unescapes = map[string]byte{}
+
+func init() {
+	for c, seq := range escapes {
+		unescapes[seq[1:]] = c
+	}
+}
+
+// isEscape reports whether s begins with an escape sequence.
+func isEscape(s string) bool {
+	if len(s) < 3 || s[0] != '\\' {
+		return false
+	}
+	_, ok := unescapes[s[1:3]]
+	return ok
+}
+
+// Escape escapes the characters of a username that are not allowed in a localpart,
+// like "d'artagnan" to "d\27artagnan" (XEP-0106). A backslash is only escaped
+// when it begins an escape sequence.
+func Escape(local string) string {
+	b := &strings.Builder{}
+	for i := 0; i < len(local); i++ {
+		c := local[i]
+		if seq, ok := escapes[c]; ok && (c != '\\' || isEscape(local[i:])) {
+			b.WriteString(seq)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Unescape reverses Escape.
+func Unescape(local string) string {
+	b := &strings.Builder{}
+	for i := 0; i < len(local); i++ {
+		if isEscape(local[i:]) {
+			b.WriteByte(unescapes[local[i+1:i+3]])
+			i += 2
+		} else {
+			b.WriteByte(local[i])
+		}
+	}
+	return b.String()
+}
+
+// NewEscapedJID is like NewJID, with the username escaped as the localpart.
+// The username must not begin or end with a space.
+func NewEscapedJID(username, domain, resource string) (JID, error) {
+	if strings.HasPrefix(username, " ") || strings.HasSuffix(username, " ") {
+		return JID{}, &JIDError{JID: joinJID(username, domain, resource), Part: "localpart",
+			Err: errors.New("begins or ends with a space")}
+	}
+	return NewJID(Escape(username), domain, resource)
+}
+
+// UnescapedLocal returns the username of the escaped localpart.
+func (jid JID) UnescapedLocal() string {
+	return Unescape(jid.local)
+}
+
+func (jid JID) Local() string {
+	return jid.local
+}
+
+func (jid JID) Domain() string {
+	return jid.domain
+}
+
+func (jid JID) Resource() string {
+	return jid.resource
+}
+
+// Bare returns the JID without the resource, as a string.
+func (jid JID) Bare() string {
+	return joinJID(jid.local, jid.domain, "")
+}
+
+// AddResource returns the JID with the resource, replacing the one of jid.
+func (jid JID) AddResource(resource string) JID {
+	if r, err := prepResource(resource); err == nil {
+		resource = r
+	}
+	jid.resource = resource
+	return jid
+}
+
+func (jid JID) Split() (local string, domain string, resource string) {
+	return jid.local, jid.domain, jid.resource
+}
+
+// IsZero reports whether jid is the zero JID, the one of an empty string.
+func (jid JID) IsZero() bool {
+	return jid == JID{}
+}
+
+// Equal reports whether the JIDs are the same address.
+func (jid JID) Equal(other JID) bool {
+	return jid == other
+}
+
+// BareEqual reports whether the JIDs are the same address, ignoring the resources.
+func (jid JID) BareEqual(other JID) bool {
+	return jid.local == other.local && jid.domain == other.domain
+}
+
+func (jid JID) String() string {
+	return joinJID(jid.local, jid.domain, jid.resource)
+}
+
+func (jid JID) MarshalText() ([]byte, error) {
+	return []byte(jid.String()), nil
+}
+
+func (jid *JID) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*jid = JID{}
+		return nil
+	}
+	j, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*jid = j
+	return nil
+}
@@ -0,0 +1,149 @@
+// jid test
+package xmpp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// the examples of XEP-0106 5.1
+var escapeTests = []struct {
+	username, local string
+}{
+	{`space cadet`, `space\20cadet`},
+	{`call me "ishmael"`, `call\20me\20\22ishmael\22`},
+	{`at&t guy`, `at\26t\20guy`},
+	{`d'artagnan`, `d\27artagnan`},
+	{`/.fanboy`, `\2f.fanboy`},
+	{`::foo::`, `\3a\3afoo\3a\3a`},
+	{`<foo>`, `\3cfoo\3e`},
+	{`user@host`, `user\40host`},
+	{`c:\net`, `c\3a\net`},
+	{`c:\\net`, `c\3a\\net`},
+	{`c:\cool stuff`, `c\3a\cool\20stuff`},
+	{`c:\5commas`, `c\3a\5c5commas`},
+}
+
+func TestEscape(t *testing.T) {
+	for _, tt := range escapeTests {
+		if got := Escape(tt.username); got != tt.local {
+			t.Errorf("Escape(%q) = %q, want %q", tt.username, got, tt.local)
+		}
+		if got := Unescape(tt.local); got != tt.username {
+			t.Errorf("Unescape(%q) = %q, want %q", tt.local, got, tt.username)
+		}
+
+		jid, err := NewEscapedJID(tt.username, "example.com", "")
+		if err != nil {
+			t.Errorf("NewEscapedJID(%q): %v", tt.username, err)
+			continue
+		}
+		if got, want := jid.String(), tt.local+"@example.com"; got != want {
+			t.Errorf("NewEscapedJID(%q) = %q, want %q", tt.username, got, want)
+		}
+		if got := jid.UnescapedLocal(); got != tt.username {
+			t.Errorf("UnescapedLocal of %q = %q, want %q", jid, got, tt.username)
+		}
+	}
+}
+
+func TestNewEscapedJIDSpace(t *testing.T) {
+	for _, username := range []string{" alice", "alice "} {
+		if _, err := NewEscapedJID(username, "example.com", ""); err == nil {
+			t.Errorf("NewEscapedJID(%q): no error", username)
+		}
+	}
+}
+
+var parseTests = []struct {
+	s, jid, part string
+}{
+	{"Juliet@Example.COM/Balcony", "juliet@example.com/Balcony", ""},
+	{"example.com.", "example.com", ""},
+	{"juliet@example.com/foo@bar/baz", "juliet@example.com/foo@bar/baz", ""},
+	{"example.com/juliet@im", "example.com/juliet@im", ""},
+	{"ÇIÇEK@EXAMPLE.COM", "çiçek@example.com", ""},
+	{"xn--bcher-kva.example", "bücher.example", ""},
+	{"BÜCHER.example", "bücher.example", ""},
+	{"juliet@192.0.2.1", "juliet@192.0.2.1", ""},
+	{"juliet@[2001:db8::1]/balcony", "juliet@[2001:db8::1]/balcony", ""},
+	{strings.Repeat("a", 1023) + "@example.com", strings.Repeat("a", 1023) + "@example.com", ""},
+	{"", "", "domainpart"},
+	{"@x", "", "localpart"},
+	{"juliet@", "", "domainpart"},
+	{"juliet@/balcony", "", "domainpart"},
+	{"a@b/", "", "resourcepart"},
+	{"jul\"iet@example.com", "", "localpart"},
+	{"juliet@[192.0.2.1]", "", "domainpart"},
+	{"juliet@[2001:db8::1", "", "domainpart"},
+	{"juliet@exa mple.com", "", "domainpart"},
+	{"juliet@example.com/bal\u0007cony", "", "resourcepart"},
+	{strings.Repeat("a", 1024) + "@example.com", "", "localpart"},
+	{strings.Repeat("a.", 512) + "com", "", "domainpart"},
+	{"juliet@example.com/" + strings.Repeat("r", 1024), "", "resourcepart"},
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range parseTests {
+		jid, err := Parse(tt.s)
+		if tt.part == "" {
+			if err != nil {
+				t.Errorf("Parse(%q): %v", tt.s, err)
+			} else if jid.String() != tt.jid {
+				t.Errorf("Parse(%q) = %q, want %q", tt.s, jid, tt.jid)
+			}
+			continue
+		}
+		var e *JIDError
+		if !errors.As(err, &e) || e.Part != tt.part {
+			t.Errorf("Parse(%q) = %q, %v, want an invalid %s", tt.s, jid, err, tt.part)
+		}
+	}
+}
+
+func TestNewJID(t *testing.T) {
+	jid, err := NewJID("Juliet", "Example.COM", "Balcony")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local, domain, resource := jid.Split(); local != "juliet" || domain != "example.com" || resource != "Balcony" {
+		t.Errorf("NewJID = %q, %q, %q", local, domain, resource)
+	}
+	if _, err := NewJID("juliet", "", ""); err == nil {
+		t.Error("NewJID without domain: no error")
+	}
+	if _, err := NewJID("jul@iet", "example.com", ""); err == nil {
+		t.Error("NewJID with '@' in the localpart: no error")
+	}
+}
+
+func TestMustParse(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustParse(\"@x\") did not panic")
+		}
+	}()
+	MustParse("@x")
+}
+
+func TestJIDEqual(t *testing.T) {
+	for _, tt := range []struct {
+		a, b        string
+		equal, bare bool
+	}{
+		{"Juliet@Example.COM/Balcony", "juliet@example.com/Balcony", true, true},
+		{"juliet@example.com/Balcony", "juliet@example.com/balcony", false, true},
+		{"juliet@xn--bcher-kva.example", "juliet@bücher.example", true, true},
+		{"juliet@example.com", "romeo@example.com", false, false},
+		{"juliet@example.com", "example.com", false, false},
+	} {
+		a, b := MustParse(tt.a), MustParse(tt.b)
+		if got := a.Equal(b); got != tt.equal {
+			t.Errorf("%q.Equal(%q) = %v, want %v", tt.a, tt.b, got, tt.equal)
+		}
+		if got := a.BareEqual(b); got != tt.bare {
+			t.Errorf("%q.BareEqual(%q) = %v, want %v", tt.a, tt.b, got, tt.bare)
+		}
+	}
+}
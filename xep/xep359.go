@@ -0,0 +1,37 @@
+// XEP-0359: Unique and Stable Stanza IDs
+// http://xmpp.org/extensions/xep-0359.html
+package xep
+
+import (
+	"encoding/xml"
+)
+
+// StanzaID is the ID assigned to a stanza by the entity By, like the server
+// archiving it or a MUC room.
+type StanzaID struct {
+	XMLName xml.Name `xml:"urn:xmpp:sid:0 stanza-id"`
+	Id      string   `xml:"id,attr"`
+	By      string   `xml:"by,attr"`
+}
+
+func (_ StanzaID) Name() string {
+	return "stanza-id"
+}
+
+func (_ StanzaID) FullName() string {
+	return "urn:xmpp:sid:0 stanza-id"
+}
+
+// OriginID is the ID assigned to a message by its sender.
+type OriginID struct {
+	XMLName xml.Name `xml:"urn:xmpp:sid:0 origin-id"`
+	Id      string   `xml:"id,attr"`
+}
+
+func (_ OriginID) Name() string {
+	return "origin-id"
+}
+
+func (_ OriginID) FullName() string {
+	return "urn:xmpp:sid:0 origin-id"
+}
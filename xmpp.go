@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/ginuerzh/goxmpp/core"
 	"github.com/ginuerzh/goxmpp/xep"
+	"strconv"
 	"strings"
 )
 
@@ -33,10 +34,13 @@ const (
 	NSIBB          = "http://jabber.org/protocol/ibb"
 	NSMUC          = "http://jabber.org/protocol/muc"
 	NSDelay        = "urn:xmpp:delay"
+	NSStanzaID     = "urn:xmpp:sid:0"
 )
 
 var clientFeatures = []string{
 	"http://jabber.org/protocol/bytestreams",
+	`jid\20escaping`,
+	"urn:xmpp:sid:0",
 }
 
 func DiscInfoResult() *xep.DiscoInfoQuery {
@@ -83,10 +87,112 @@ type Stan interface {
 type Stanza struct {
 	XMLName xml.Name
 	core.StanzaHeader
+	// Attr are the other attributes of the stanza.
+	Attr     []xml.Attr
 	Err      error
 	Elements []Element
 }
 
+const nsXML = "http://www.w3.org/XML/1998/namespace"
+
+// MarshalXML writes the stanza with its attributes, its elements, then its error.
+// An error that is not a *core.StanzaError is written as undefined-condition.
+func (st Stanza) MarshalXML(enc *xml.Encoder, _ xml.StartElement) error {
+	start := xml.StartElement{Name: st.XMLName}
+	for _, attr := range []xml.Attr{
+		{Name: xml.Name{Local: "id"}, Value: st.Ids},
+		{Name: xml.Name{Local: "type"}, Value: st.Types},
+		{Name: xml.Name{Local: "from"}, Value: st.From},
+		{Name: xml.Name{Local: "to"}, Value: st.To},
+		{Name: xml.Name{Space: nsXML, Local: "lang"}, Value: st.Lang},
+	} {
+		if attr.Value != "" {
+			start.Attr = append(start.Attr, attr)
+		}
+	}
+	start.Attr = append(start.Attr, st.Attr...)
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, e := range st.Elements {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	if st.Err != nil {
+		e, ok := st.Err.(*core.StanzaError)
+		if !ok {
+			e = core.NewStanzaError(core.StanzaUndefinedCondition, st.Err.Error())
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// UnmarshalXML reads the stanza, decoding its elements with the registered types,
+// or as RawElement if not registered.
+func (st *Stanza) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	st.XMLName = start.Name
+	// the prefixes declared by the stanza, in scope of its elements
+	var ns []xml.Attr
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == "xmlns":
+			ns = append(ns, attr)
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			// declared on each stanza over WebSocket (RFC 7395 3.3.3).
+		case attr.Name.Space == "" && attr.Name.Local == "id":
+			st.Ids = attr.Value
+		case attr.Name.Space == "" && attr.Name.Local == "type":
+			st.Types = attr.Value
+		case attr.Name.Space == "" && attr.Name.Local == "from":
+			st.From = attr.Value
+		case attr.Name.Space == "" && attr.Name.Local == "to":
+			st.To = attr.Value
+		case attr.Name.Space == nsXML && attr.Name.Local == "lang":
+			st.Lang = attr.Value
+		default:
+			st.Attr = append(st.Attr, attr)
+		}
+	}
+
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		var se xml.StartElement
+		switch t := t.(type) {
+		case xml.StartElement:
+			se = t
+		case xml.EndElement:
+			return nil
+		default:
+			continue
+		}
+
+		elem := E(se.Name.Space + " " + se.Name.Local)
+		if elem == nil {
+			elem = &RawElement{}
+		}
+		if err := dec.DecodeElement(elem, &se); err != nil {
+			return err
+		}
+		if raw, ok := elem.(*RawElement); ok {
+			raw.NS = append(raw.NS, ns...)
+		}
+		if err, ok := elem.(*core.StanzaError); ok {
+			st.Err = err
+		} else {
+			st.AddE(elem)
+		}
+	}
+}
+
 func (st Stanza) Name() string {
 	return st.XMLName.Local
 }
@@ -111,6 +217,28 @@ func (st *Stanza) AddE(elements ...Element) {
 	st.Elements = append(st.Elements, elements...)
 }
 
+// StanzaID returns the ID assigned to the stanza by the entity by (XEP-0359),
+// like the bare JID of the account for its archive, or the JID of a MUC room.
+// The stanza-id elements of other entities are ignored, they may be forged.
+func (st Stanza) StanzaID(by string) (string, bool) {
+	for _, e := range st.Elements {
+		if sid, ok := e.(*xep.StanzaID); ok && ToJID(sid.By).Equal(ToJID(by)) {
+			return sid.Id, true
+		}
+	}
+	return "", false
+}
+
+// OriginID returns the ID assigned to the message by its sender (XEP-0359).
+func (st Stanza) OriginID() string {
+	for _, e := range st.Elements {
+		if oid, ok := e.(*xep.OriginID); ok {
+			return oid.Id
+		}
+	}
+	return ""
+}
+
 func (st *Stanza) Error() error {
 	return st.Err
 }
@@ -124,62 +252,101 @@ func (st *Stanza) String() string {
 	return b.String()
 }
 
-type JID string
-
-func ToJID(s string) JID {
-	return JID(s)
+// RawElement is an element that is not registered, kept as received: its name,
+// its attributes and its inner XML, to be inspected or sent again unchanged.
+type RawElement struct {
+	XMLName  xml.Name
+	Attr     []xml.Attr `xml:",any,attr"`
+	InnerXML string     `xml:",innerxml"`
+	// NS are the namespace prefixes declared by the ancestors of the element,
+	// like the stanza and the stream header, innermost first. The inner XML may
+	// use them.
+	NS []xml.Attr `xml:"-"`
 }
 
-func (jid JID) Bare() string {
-	a := strings.SplitN(jid.String(), "/", 2)
-	return a[0]
+func (e RawElement) Name() string {
+	return e.XMLName.Local
 }
 
-func (jid JID) Local() string {
-	a := strings.Split(jid.String(), "@")
-	return a[0]
+func (e RawElement) FullName() string {
+	return e.XMLName.Space + " " + e.XMLName.Local
 }
 
-func (jid JID) Domain() string {
-	a := strings.SplitN(jid.Bare(), "@", 2)
-	return a[1]
+func (e RawElement) String() string {
+	return "[raw] " + e.XMLName.Space + " " + e.XMLName.Local
 }
 
-func (jid JID) Resource() string {
-	a := strings.SplitN(jid.String(), "/", 2)
-	if len(a) != 2 {
-		return ""
+// MarshalXML writes the element with its namespace declarations and prefixes,
+// which the inner XML may depend on, and the inner XML as is. The prefixes of
+// the ancestors that the element may use are declared again on it.
+func (e RawElement) MarshalXML(enc *xml.Encoder, _ xml.StartElement) error {
+	start := xml.StartElement{Name: xml.Name{Local: e.XMLName.Local}}
+	if e.XMLName.Space != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: e.XMLName.Space})
 	}
 
-	return a[1]
-}
-
-func (jid JID) AddResource(resource string) JID {
-	a := strings.SplitN(jid.String(), "/", 2)
-	return ToJID(a[0] + "/" + resource)
-}
-
-func (jid JID) Split() (local string, domain string, resource string) {
-	a := strings.SplitN(string(jid), "@", 2)
-	if len(a) != 2 {
-		return
+	prefixes := map[string]string{nsXML: "xml"} // by namespace
+	declared := map[string]bool{"xml": true}
+	for _, attr := range e.Attr {
+		if attr.Name.Space == "xmlns" {
+			prefixes[attr.Value] = attr.Name.Local
+			declared[attr.Name.Local] = true
+		}
 	}
-	local = a[0]
-
-	a = strings.SplitN(a[1], "/", 2)
-	domain = a[0]
-	if len(a) != 2 {
-		return
+	declare := func(prefix, space string) {
+		prefixes[space] = prefix
+		declared[prefix] = true
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:" + prefix}, Value: space})
+	}
+	for _, ns := range e.NS {
+		if !declared[ns.Name.Local] && strings.Contains(e.InnerXML, ns.Name.Local+":") {
+			declare(ns.Name.Local, ns.Value)
+		}
+	}
+	// inScope returns the prefix of the namespace declared by an ancestor, if not redeclared.
+	inScope := func(space string) string {
+		for _, ns := range e.NS {
+			if ns.Value == space && !declared[ns.Name.Local] {
+				return ns.Name.Local
+			}
+		}
+		return ""
 	}
 
-	resource = a[1]
-	return
-}
+	var attrs []xml.Attr
+	for _, attr := range e.Attr {
+		switch attr.Name.Space {
+		case "":
+			if attr.Name.Local == "xmlns" {
+				continue
+			}
+		case "xmlns":
+			attr.Name = xml.Name{Local: "xmlns:" + attr.Name.Local}
+		default:
+			prefix, ok := prefixes[attr.Name.Space]
+			if !ok {
+				if prefix = inScope(attr.Name.Space); prefix == "" {
+					// not one of the prefixes the element already uses
+					for n := 1; prefix == "" || declared[prefix]; n++ {
+						prefix = "ns" + strconv.Itoa(n)
+					}
+				}
+				declare(prefix, attr.Name.Space)
+			}
+			attr.Name = xml.Name{Local: prefix + ":" + attr.Name.Local}
+		}
+		attrs = append(attrs, attr)
+	}
+	start.Attr = append(start.Attr, attrs...)
 
-func (jid JID) String() string {
-	return string(jid)
+	return enc.EncodeElement(struct {
+		InnerXML string `xml:",innerxml"`
+	}{e.InnerXML}, start)
 }
 
+// NullElement is an empty element.
+//
+// Deprecated: unknown elements are decoded as RawElement.
 type NullElement struct {
 	XMLName xml.Name
 }
@@ -229,6 +396,18 @@ func NewMessage(typ string, to string, body string, subject string) *Stanza {
 	return msg
 }
 
+// NewErrorReply returns the error reply to the stanza (RFC 6120 8.3.1):
+// of the same kind and id, addressed to its sender.
+func NewErrorReply(st *Stanza, err *core.StanzaError) *Stanza {
+	reply := NewStanza(st.Name())
+	reply.Types = "error"
+	reply.Ids = st.Ids
+	reply.From = st.To
+	reply.To = st.From
+	reply.Err = err
+	return reply
+}
+
 func NewPresence(typ string, id string, to string, e ...Element) *Stanza {
 	presence := NewStanza("presence", e...)
 	presence.Types = typ
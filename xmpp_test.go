@@ -0,0 +1,142 @@
+// xmpp test
+package xmpp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"github.com/ginuerzh/goxmpp/core"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// names returns the namespaces and the local names of the elements and the
+// attributes of the document, failing if it is not well-formed.
+func names(t *testing.T, data []byte) []string {
+	var names []string
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("%s: %v", data, err)
+			}
+			return names
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			names = append(names, se.Name.Space+" "+se.Name.Local)
+			for _, attr := range se.Attr {
+				if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+					names = append(names, "@"+attr.Name.Space+" "+attr.Name.Local)
+				}
+			}
+		}
+	}
+}
+
+func TestRawElementNamespaces(t *testing.T) {
+	// the prefix x is declared by the stanza.
+	st := &Stanza{}
+	if err := xml.Unmarshal([]byte("<message xmlns='jabber:client' xmlns:x='urn:x'>"+
+		"<foo xmlns='urn:foo'><x:bar x:baz='1'/></foo></message>"), st); err != nil {
+		t.Fatal(err)
+	}
+	data, err := xml.Marshal(st.Elements[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"urn:foo foo", "urn:x bar", "@urn:x baz"}
+	if got := names(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %q, want %q", data, got, want)
+	}
+
+	// the generated prefixes do not replace the ones the element uses.
+	e := RawElement{
+		XMLName: xml.Name{Space: "urn:foo", Local: "foo"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Space: "xmlns", Local: "ns1"}, Value: "urn:a"},
+			{Name: xml.Name{Space: "urn:b", Local: "b"}, Value: "1"},
+			{Name: xml.Name{Space: "urn:y", Local: "y"}, Value: "2"},
+		},
+		InnerXML: "<ns1:a/><ns2:c/>",
+		NS: []xml.Attr{
+			{Name: xml.Name{Space: "xmlns", Local: "ns2"}, Value: "urn:c"},
+			{Name: xml.Name{Space: "xmlns", Local: "y"}, Value: "urn:y"},
+		},
+	}
+	if data, err = xml.Marshal(e); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"urn:foo foo", "@urn:b b", "@urn:y y", "urn:a a", "urn:c c"}
+	if got := names(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %q, want %q", data, got, want)
+	}
+}
+
+func TestStanzaRoundTrip(t *testing.T) {
+	const data = "<message xmlns='jabber:client' xmlns:x='urn:x' id='m1' type='error' " +
+		"from='juliet@example.com/balcony' to='romeo@example.net' xml:lang='fr' priority='high' x:hint='1'>" +
+		"<foo xmlns='urn:foo'>bar</foo>" +
+		"<error type='cancel' by='example.net'>" +
+		"<service-unavailable xmlns='urn:ietf:params:xml:ns:xmpp-stanzas'/>" +
+		"<text xmlns='urn:ietf:params:xml:ns:xmpp-stanzas' xml:lang='en'>offline</text>" +
+		"</error></message>"
+	check := func(data []byte, st *Stanza) {
+		t.Helper()
+		if st.XMLName.Local != "message" || st.Ids != "m1" || st.Types != "error" ||
+			st.From != "juliet@example.com/balcony" || st.To != "romeo@example.net" || st.Lang != "fr" {
+			t.Errorf("%s: unexpected header %+v", data, st.StanzaHeader)
+		}
+		attrs := map[string]string{}
+		for _, attr := range st.Attr {
+			attrs[attr.Name.Space+" "+attr.Name.Local] = attr.Value
+		}
+		if len(attrs) != 2 || attrs[" priority"] != "high" || attrs["urn:x hint"] != "1" {
+			t.Errorf("%s: unexpected attributes %v", data, st.Attr)
+		}
+		if len(st.Elements) != 1 || st.Elements[0].FullName() != "urn:foo foo" {
+			t.Errorf("%s: unexpected elements %v", data, st.Elements)
+		}
+		e, ok := st.Err.(*core.StanzaError)
+		if !ok {
+			t.Fatalf("%s: got error %v, want a stanza error", data, st.Err)
+		}
+		if !errors.Is(e, core.StanzaServiceUnavailable) || e.Type != "cancel" || e.By != "example.net" ||
+			e.Text != "offline" || e.Lang != "en" {
+			t.Errorf("%s: unexpected error %+v", data, e)
+		}
+	}
+
+	st := &Stanza{}
+	if err := xml.Unmarshal([]byte(data), st); err != nil {
+		t.Fatal(err)
+	}
+	check([]byte(data), st)
+
+	out, err := xml.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st2 := &Stanza{}
+	if err := xml.Unmarshal(out, st2); err != nil {
+		t.Fatalf("%s: %v", out, err)
+	}
+	check(out, st2)
+	if !bytes.Contains(out, []byte("<foo xmlns=\"urn:foo\">bar</foo>")) {
+		t.Errorf("%s: the element is not kept", out)
+	}
+
+	// other errors are written as undefined-condition.
+	st2.Err = errors.New("failed")
+	if out, err = xml.Marshal(st2); err != nil {
+		t.Fatal(err)
+	}
+	st3 := &Stanza{}
+	if err := xml.Unmarshal(out, st3); err != nil {
+		t.Fatalf("%s: %v", out, err)
+	}
+	if e, ok := st3.Err.(*core.StanzaError); !ok || !errors.Is(e, core.StanzaUndefinedCondition) || e.Text != "failed" {
+		t.Errorf("%s: got error %v, want undefined-condition", out, st3.Err)
+	}
+}